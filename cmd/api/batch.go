@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// maxBatchOperations bounds the number of operations in a single batch.
+const maxBatchOperations = 100
+
+// errBatchFailed rolls back the transaction of a batch after one of its
+// operations failed.
+var errBatchFailed = errors.New("batch operation failed")
+
+type movieBatchOperation struct {
+	Op      string     `json:"op"`
+	ID      int64      `json:"id"`
+	Version int64      `json:"version"`
+	Movie   movieInput `json:"movie"`
+}
+
+type movieBatchResult struct {
+	Op     string      `json:"op"`
+	ID     int64       `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Movie  *data.Movie `json:"movie,omitempty"`
+	Error  any         `json:"error,omitempty"`
+}
+
+func (app *application) batchMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Operations []movieBatchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	allowDuplicates := app.readBool(r.URL.Query(), "allow_duplicates", false, v)
+
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+
+	for i, operation := range input.Operations {
+		field := "operations." + strconv.Itoa(i)
+
+		v.Check(validator.In(operation.Op, "create", "update", "delete"), field+".op", "must be create, update or delete")
+
+		if operation.Op == "create" {
+			v.Check(operation.ID == 0, field+".id", "must not be provided")
+			v.Check(operation.Version == 0, field+".version", "must not be provided")
+		} else {
+			v.Check(operation.ID > 0, field+".id", "must be a valid movie id")
+			v.Check(operation.Version > 0, field+".version", "must be provided")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	results := make([]movieBatchResult, 0, len(input.Operations))
+	failed := -1
+
+	err = app.models.Movie.Transaction(func(tx *data.MovieTx) error {
+		for i, operation := range input.Operations {
+			result, err := app.runMovieBatchOperation(tx, operation, userID, allowDuplicates)
+			if err != nil {
+				return err
+			}
+
+			results = append(results, result)
+
+			if result.Status >= http.StatusBadRequest {
+				failed = i
+				return errBatchFailed
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if failed >= 0 {
+		env := envelope{
+			"error":   fmt.Sprintf("operation %d failed, so none of the operations were applied", failed),
+			"results": results,
+		}
+
+		err = app.writeJSON(w, env, results[failed].Status, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"results": results}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runMovieBatchOperation applies a single batch operation within tx. Failures
+// that the client can act on are reported through the status and error of the
+// result; the returned error is only set for unexpected failures. Creates are
+// checked for duplicates the same way as single ones, movies created earlier in
+// the batch included.
+func (app *application) runMovieBatchOperation(tx *data.MovieTx, operation movieBatchOperation, userID int64, allowDuplicates bool) (movieBatchResult, error) {
+	result := movieBatchResult{Op: operation.Op, ID: operation.ID}
+
+	var movie *data.Movie
+
+	if operation.Op == "create" {
+		movie = &data.Movie{}
+	} else {
+		var err error
+
+		movie, err = tx.Get(operation.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return result.fail(http.StatusNotFound, "the requested resource could not be found"), nil
+			default:
+				return result, err
+			}
+		}
+
+		if movie.Version != operation.Version {
+			return result.fail(http.StatusConflict, "unable to update the record due to an edit conflict, please try again"), nil
+		}
+	}
+
+	if operation.Op == "delete" {
+		err := tx.Delete(movie.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				return result.fail(http.StatusNotFound, "the requested resource could not be found"), nil
+			default:
+				return result, err
+			}
+		}
+
+		result.Status = http.StatusOK
+		return result, nil
+	}
+
+	operation.Movie.apply(movie)
+
+	v := validator.New()
+
+	err := app.validateMovie(v, movie, tx.EnsureGenres)
+	if err != nil {
+		return result, err
+	}
+
+	if !v.Valid() {
+		return result.fail(http.StatusUnprocessableEntity, v.Errors), nil
+	}
+
+	if operation.Op == "create" {
+		duplicates, err := tx.FindDuplicates(movie)
+		if err != nil {
+			return result, err
+		}
+
+		if len(duplicates) > 0 && (!allowDuplicates || duplicates[0].Reason == "external_id") {
+			return result.fail(http.StatusConflict, map[string]any{
+				"message":    "the movie appears to already exist",
+				"duplicates": duplicates,
+			}), nil
+		}
+	}
+
+	if operation.Op == "create" {
+		err = tx.Insert(movie, userID)
+		result.Status = http.StatusCreated
+	} else {
+		err = tx.Update(movie, userID)
+		result.Status = http.StatusOK
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return result.fail(http.StatusConflict, "unable to update the record due to an edit conflict, please try again"), nil
+		case errors.Is(err, data.ErrUnknownPerson):
+			return result.fail(http.StatusUnprocessableEntity, map[string]string{"credits": "must only reference existing people"}), nil
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			return result.fail(http.StatusUnprocessableEntity, map[string]string{"external_ids": "must not be linked to another movie"}), nil
+		default:
+			return result, err
+		}
+	}
+
+	result.ID = movie.ID
+	result.Movie = movie
+
+	return result, nil
+}
+
+func (result movieBatchResult) fail(status int, message any) movieBatchResult {
+	result.Status = status
+	result.Error = message
+
+	return result
+}
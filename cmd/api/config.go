@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -33,6 +34,32 @@ type config struct {
 	jwt struct {
 		secret string
 	}
+	search struct {
+		language string
+	}
+	genres struct {
+		autoCreate bool
+	}
+	storage struct {
+		dir     string
+		baseURL string
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	similar struct {
+		refreshInterval time.Duration
+	}
+	recommendations struct {
+		refreshInterval time.Duration
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
 }
 
 var (
@@ -68,6 +95,24 @@ func (cnf *config) New() {
 
 	flag.StringVar(&cnf.jwt.secret, "jwt-secret", "", "JWT secret")
 
+	flag.StringVar(&cnf.search.language, "search-language", "simple", "Default text search language for movie titles")
+
+	flag.BoolVar(&cnf.genres.autoCreate, "genres-auto-create", false, "Add unknown movie genres to the catalog instead of rejecting them")
+
+	flag.DurationVar(&cnf.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash before they are purged")
+	flag.DurationVar(&cnf.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is purged")
+
+	flag.StringVar(&cnf.storage.dir, "storage-dir", "./uploads", "Directory uploaded media is stored in")
+	flag.StringVar(&cnf.storage.baseURL, "media-base-url", "/v1/media", "Base URL uploaded media is served from")
+
+	flag.DurationVar(&cnf.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key header are kept for replay")
+
+	flag.DurationVar(&cnf.similar.refreshInterval, "similar-refresh-interval", 6*time.Hour, "How often similar movies are recomputed (0 disables it)")
+
+	flag.DurationVar(&cnf.recommendations.refreshInterval, "recommendations-refresh-interval", 6*time.Hour, "How often the movie neighbors behind personal recommendations are recomputed (0 disables it)")
+
+	flag.DurationVar(&cnf.stats.cacheTTL, "stats-cache-ttl", 5*time.Minute, "How long movie stats are cached for (0 disables caching)")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -12,7 +12,7 @@ type contextKey string
 const userContextKey = contextKey("user")
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
-	ctx := context.WithValue(context.Background(), userContextKey, user)
+	ctx := context.WithValue(r.Context(), userContextKey, user)
 	return r.WithContext(ctx)
 }
 
@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+
+	"greenlight.nesty.net/internal/data"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -37,6 +39,39 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since you last retrieved it"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %q content type is not supported for this resource", r.Header.Get("Content-Type"))
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the Idempotency-Key header has already been used for a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, message)
+}
+
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same Idempotency-Key header is still being processed, please try again"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) duplicateMovieResponse(w http.ResponseWriter, r *http.Request, duplicates []*data.MovieDuplicate) {
+	message := map[string]any{
+		"message":    "the movie appears to already exist",
+		"duplicates": duplicates,
+	}
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (app *application) defaultListResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the default watchlist can't be deleted"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
 
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// exportFormats are the formats the movie catalog can be exported in.
+var exportFormats = []string{"csv", "ndjson", "json"}
+
+// movieExporter writes a stream of movies in one export format. begin is called
+// once before the first movie and end once after the last one.
+type movieExporter interface {
+	contentType() string
+	begin() error
+	write(movie *data.Movie) error
+	end() error
+}
+
+func (app *application) exportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	query := app.readMovieQuery(qs, v)
+
+	// As in listMoviesHandler, the watched filter is relative to the
+	// authenticated user.
+	if qs.Has("watched") {
+		watched := app.readBool(qs, "watched", false, v)
+		query.Watched = &watched
+		query.WatchedBy = app.contextGetUser(r).ID
+	}
+
+	format := app.readString(qs, "format", "json")
+
+	data.ValidateMovieQuery(v, &query)
+
+	if v.Check(validator.In(format, exportFormats...), "format", "invalid format value"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var exporter movieExporter
+
+	switch format {
+	case "csv":
+		exporter = &csvMovieExporter{writer: csv.NewWriter(w)}
+	case "ndjson":
+		exporter = &ndjsonMovieExporter{encoder: json.NewEncoder(w)}
+	default:
+		exporter = &jsonMovieExporter{w: w}
+	}
+
+	// A full dump takes longer to write than the server timeout allows for a
+	// regular response.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(30 * time.Minute))
+
+	started := false
+
+	start := func() error {
+		started = true
+
+		w.Header().Set("Content-Type", exporter.contentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+		w.WriteHeader(http.StatusOK)
+
+		return exporter.begin()
+	}
+
+	err := app.models.Movie.Export(r.Context(), query, func(movie *data.Movie) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		return exporter.write(movie)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = exporter.end()
+	}
+
+	switch {
+	case err == nil:
+	case !started:
+		app.serverErrorResponse(w, r, err)
+	case r.Context().Err() != nil:
+		// The client went away, so there's nobody left to tell.
+	default:
+		// The status line has already been sent, so all that's left is to
+		// log the error and cut the export short.
+		app.logError(r, err)
+	}
+}
+
+type csvMovieExporter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func (exporter *csvMovieExporter) contentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+// exportCSVColumns are the columns of a CSV export. Genres are separated by "|"
+// and the external ids and thumbnails are written as JSON objects, the way a
+// CSV import reads them back.
+var exportCSVColumns = []string{
+	"id", "created_at", "title", "year", "runtime", "genres", "average_rating", "rating_count", "external_ids",
+	"poster_url", "poster_thumbnails", "backdrop_url", "backdrop_thumbnails", "version",
+}
+
+func (exporter *csvMovieExporter) begin() error {
+	return exporter.writer.Write(exportCSVColumns)
+}
+
+func (exporter *csvMovieExporter) write(movie *data.Movie) error {
+	externalIDs, err := csvObject(movie.ExternalIDs)
+	if err != nil {
+		return err
+	}
+
+	posterThumbnails, err := csvObject(movie.PosterThumbnails)
+	if err != nil {
+		return err
+	}
+
+	backdropThumbnails, err := csvObject(movie.BackdropThumbnails)
+	if err != nil {
+		return err
+	}
+
+	exporter.record = append(exporter.record[:0],
+		strconv.FormatInt(movie.ID, 10),
+		movie.CreatedAt.Format(time.RFC3339),
+		movie.Title,
+		strconv.FormatInt(int64(movie.Year), 10),
+		strconv.FormatInt(int64(movie.Runtime), 10),
+		strings.Join(movie.Genres, "|"),
+		strconv.FormatFloat(movie.AverageRating, 'f', -1, 64),
+		strconv.FormatInt(int64(movie.RatingCount), 10),
+		externalIDs,
+		movie.PosterURL,
+		posterThumbnails,
+		movie.BackdropURL,
+		backdropThumbnails,
+		strconv.FormatInt(movie.Version, 10),
+	)
+
+	return exporter.writer.Write(exporter.record)
+}
+
+// csvObject encodes a map as a JSON object for a CSV field, leaving the field
+// empty when the map is.
+func csvObject(m map[string]string) (string, error) {
+	if len(m) == 0 {
+		return "", nil
+	}
+
+	js, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	return string(js), nil
+}
+
+func (exporter *csvMovieExporter) end() error {
+	exporter.writer.Flush()
+	return exporter.writer.Error()
+}
+
+type ndjsonMovieExporter struct {
+	encoder *json.Encoder
+}
+
+func (exporter *ndjsonMovieExporter) contentType() string {
+	return "application/x-ndjson"
+}
+
+func (exporter *ndjsonMovieExporter) begin() error {
+	return nil
+}
+
+func (exporter *ndjsonMovieExporter) write(movie *data.Movie) error {
+	return exporter.encoder.Encode(movie)
+}
+
+func (exporter *ndjsonMovieExporter) end() error {
+	return nil
+}
+
+// jsonMovieExporter writes a {"movies": [...]} document one movie at a time.
+type jsonMovieExporter struct {
+	w     io.Writer
+	count int
+}
+
+func (exporter *jsonMovieExporter) contentType() string {
+	return "application/json"
+}
+
+func (exporter *jsonMovieExporter) begin() error {
+	_, err := io.WriteString(exporter.w, `{"movies":[`)
+	return err
+}
+
+func (exporter *jsonMovieExporter) write(movie *data.Movie) error {
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return err
+	}
+
+	if exporter.count > 0 {
+		js = append([]byte{','}, js...)
+	}
+	exporter.count++
+
+	_, err = exporter.w.Write(append(js, '\n'))
+	return err
+}
+
+func (exporter *jsonMovieExporter) end() error {
+	_, err := io.WriteString(exporter.w, "]}\n")
+	return err
+}
@@ -5,23 +5,30 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.nesty.net/internal/data"
 	"greenlight.nesty.net/internal/validator"
 )
 
 type envelope map[string]any
 
 func (app *application) readIDParams(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -44,6 +51,25 @@ func (app *application) writeJSON(w http.ResponseWriter, data any, status int, h
 	return nil
 }
 
+// movieETag returns the entity tag for the current version of a movie.
+func (app *application) movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value matches
+// the given entity tag. Weak tags are compared by their opaque value only.
+func (app *application) etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
@@ -80,6 +106,22 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+// readMediaType returns the media type of the request body without its
+// parameters, or "invalid" when the Content-Type header can't be parsed.
+func (app *application) readMediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "invalid"
+	}
+
+	return mediaType
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 
@@ -106,6 +148,54 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return b
+}
+
+func (app *application) readTime(qs url.Values, key string, defaultValue time.Time, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return defaultValue
+	}
+
+	return t
+}
+
+func (app *application) readRuntime(qs url.Values, key string, defaultValue data.Runtime, v *validator.Validator) data.Runtime {
+	s := qs.Get(key)
+
+	if s == "" {
+		return defaultValue
+	}
+
+	runtime, err := data.ParseRuntime(s)
+	if err != nil {
+		v.AddError(key, `must be in the "<runtime> mins" format`)
+		return defaultValue
+	}
+
+	return runtime
+}
+
 func (app *application) readCSV(qs url.Values, key string, defaultValue []string) []string {
 	csv := qs.Get(key)
 
@@ -128,3 +218,28 @@ func (app *application) backgropund(fn func()) {
 		fn()
 	}()
 }
+
+// schedule runs fn in the background every interval until the server shuts
+// down. A panic in one run is logged and doesn't stop the later runs.
+func (app *application) schedule(interval time.Duration, fn func()) {
+	app.backgropund(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.done:
+				return
+			case <-ticker.C:
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							app.logger.PrintError(fmt.Errorf("%s", err), nil)
+						}
+					}()
+					fn()
+				}()
+			}
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// markMovieWatchedHandler records that the authenticated user watched a movie.
+// The body is optional: without it the movie is marked as watched now, and a
+// movie that was already watched is counted as a rewatch.
+func (app *application) markMovieWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		WatchedAt    *time.Time `json:"watched_at"`
+		RewatchCount *int32     `json:"rewatch_count"`
+	}
+
+	if r.ContentLength != 0 {
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	movie, err := app.models.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	watched := &data.WatchedMovie{
+		WatchedAt: time.Now().Truncate(time.Second),
+		Movie:     movie,
+	}
+
+	if input.WatchedAt != nil {
+		watched.WatchedAt = *input.WatchedAt
+	}
+
+	v := validator.New()
+
+	if data.ValidateWatchedMovie(v, watched, input.RewatchCount); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.WatchHistory.Record(app.contextGetUser(r).ID, watched, input.RewatchCount)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"watched": watched}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unmarkMovieWatchedHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.WatchHistory.Delete(app.contextGetUser(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "movie successfully removed from your watch history"}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWatchHistoryHandler lists the movies the authenticated user has watched,
+// along with stats summing up every viewing in the requested period rather than
+// just the current page.
+func (app *application) listWatchHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query   data.WatchHistoryQuery
+		Filters data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query.WatchedAfter = app.readTime(qs, "watched_after", time.Time{}, v)
+	input.Query.WatchedBefore = app.readTime(qs, "watched_before", time.Time{}, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-watched_at")
+	input.Filters.SortSafelist = []string{"id", "watched_at", "title", "year", "-id", "-watched_at", "-title", "-year"}
+
+	data.ValidateWatchHistoryQuery(v, &input.Query)
+
+	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+
+	history, metadata, err := app.models.WatchHistory.GetAllForUser(userID, input.Query, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats, err := app.models.WatchHistory.GetStats(userID, input.Query)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"history": history, "stats": stats, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
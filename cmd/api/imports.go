@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+const (
+	// maxImportBytes bounds the size of an import body, which is streamed
+	// rather than read through readJSON and its 1MB limit.
+	maxImportBytes = 256 << 20
+	// maxImportRowBytes bounds a single NDJSON line.
+	maxImportRowBytes = 1 << 20
+	// maxImportErrors bounds the number of rows listed in the error report.
+	// The invalid count always covers every row.
+	maxImportErrors = 1000
+	// importBatchSize is the number of valid rows checked and inserted at a
+	// time.
+	importBatchSize = 500
+)
+
+// importCSVColumns are the columns a CSV import must have, in any order.
+// Genres are separated by "|" within their column.
+var importCSVColumns = []string{"title", "year", "runtime", "genres"}
+
+// importOptionalCSVColumns are the columns a CSV import may have. The external
+// ids and thumbnails are JSON objects, as written by a CSV export.
+var importOptionalCSVColumns = []string{"external_ids", "poster_url", "poster_thumbnails", "backdrop_url", "backdrop_thumbnails"}
+
+// importIgnoredCSVColumns are the columns of a CSV export that are set by the
+// server, and so are skipped when the export is imported.
+var importIgnoredCSVColumns = []string{"id", "created_at", "average_rating", "rating_count", "version"}
+
+type importRow struct {
+	row   int
+	movie *data.Movie
+}
+
+type importRowError struct {
+	Row    int               `json:"row"`
+	Errors map[string]string `json:"errors"`
+}
+
+type importReport struct {
+	DryRun   bool             `json:"dry_run"`
+	Total    int              `json:"total"`
+	Valid    int              `json:"valid"`
+	Invalid  int              `json:"invalid"`
+	Imported int              `json:"imported"`
+	Errors   []importRowError `json:"errors"`
+}
+
+func (report *importReport) addError(row int, rowErrors map[string]string) {
+	report.Invalid++
+
+	if len(report.Errors) < maxImportErrors {
+		report.Errors = append(report.Errors, importRowError{Row: row, Errors: rowErrors})
+	}
+}
+
+func (app *application) importMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var next func() (int, *data.Movie, map[string]string, error)
+
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	switch app.readMediaType(r) {
+	case "text/csv":
+		var err error
+
+		next, err = app.readCSVMovies(body)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	case "application/x-ndjson", "application/ndjson":
+		next = app.readNDJSONMovies(body)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	// Large catalogs take longer to upload and insert than the server timeouts
+	// allow for a regular request.
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Now().Add(10 * time.Minute))
+	rc.SetWriteDeadline(time.Now().Add(15 * time.Minute))
+
+	var knownGenres []string
+
+	if !app.config.genres.autoCreate {
+		var err error
+
+		knownGenres, err = app.models.Genre.GetSlugs()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	report := &importReport{DryRun: dryRun, Errors: []importRowError{}}
+
+	// seen holds the external ids of the rows checked so far, so that rows of
+	// different batches can't claim the same one either.
+	seen := make(map[string]map[string]bool)
+
+	// bodyErr is set when the body itself can't be read, as opposed to one of
+	// its rows being invalid.
+	var bodyErr error
+
+	// importRows validates and checks the rows of the body one batch at a time,
+	// handing the valid movies of each batch to insert, unless it's nil. Only
+	// the batch at hand is held in memory.
+	importRows := func(insert func(movies []*data.Movie) error) error {
+		rows := make([]importRow, 0, importBatchSize)
+
+		flush := func() error {
+			valid, err := app.checkImportCredits(rows, report)
+			if err != nil {
+				return err
+			}
+
+			valid, err = app.checkImportExternalIDs(valid, seen, report)
+			if err != nil {
+				return err
+			}
+
+			report.Valid += len(valid)
+
+			if insert == nil || len(valid) == 0 {
+				return nil
+			}
+
+			movies := make([]*data.Movie, len(valid))
+
+			for i, row := range valid {
+				movies[i] = row.movie
+			}
+
+			return insert(movies)
+		}
+
+		for {
+			row, movie, rowErrors, err := next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				bodyErr = err
+				return err
+			}
+
+			report.Total++
+
+			if rowErrors != nil {
+				report.addError(row, rowErrors)
+				continue
+			}
+
+			movie.Genres = data.GenreSlugs(movie.Genres)
+
+			rv := validator.New()
+
+			if data.ValidateMovie(rv, movie, knownGenres); !rv.Valid() {
+				report.addError(row, rv.Errors)
+				continue
+			}
+
+			rows = append(rows, importRow{row: row, movie: movie})
+
+			if len(rows) == importBatchSize {
+				err = flush()
+				if err != nil {
+					return err
+				}
+
+				rows = rows[:0]
+			}
+		}
+
+		return flush()
+	}
+
+	var err error
+
+	if dryRun {
+		err = importRows(nil)
+	} else {
+		userID := app.contextGetUser(r).ID
+
+		err = app.models.Movie.Import(func(tx *data.MovieTx) error {
+			return importRows(func(movies []*data.Movie) error {
+				if app.config.genres.autoCreate {
+					genres := []string{}
+
+					for _, movie := range movies {
+						genres = append(genres, movie.Genres...)
+					}
+
+					err := tx.EnsureGenres(genres)
+					if err != nil {
+						return err
+					}
+				}
+
+				err := tx.InsertMany(movies, userID)
+				if err != nil {
+					return err
+				}
+
+				report.Imported += len(movies)
+
+				return nil
+			})
+		})
+	}
+	if err != nil {
+		switch {
+		case bodyErr != nil:
+			app.badRequestResponse(w, r, bodyErr)
+		case errors.Is(err, data.ErrUnknownPerson):
+			v.AddError("credits", "must only reference existing people")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be linked to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if report.Imported > 0 {
+		status = http.StatusCreated
+	}
+
+	err = app.writeJSON(w, envelope{"import": report}, status, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkImportCredits reports the rows whose credits reference people that don't
+// exist, and returns the remaining rows.
+func (app *application) checkImportCredits(rows []importRow, report *importReport) ([]importRow, error) {
+	ids := []int64{}
+
+	for _, row := range rows {
+		for _, credits := range [][]data.Credit{row.movie.Directors, row.movie.Cast} {
+			for _, credit := range credits {
+				ids = append(ids, credit.PersonID)
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return rows, nil
+	}
+
+	existing, err := app.models.Person.GetExistingIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := rows[:0]
+
+	for _, row := range rows {
+		known := true
+
+		for _, credits := range [][]data.Credit{row.movie.Directors, row.movie.Cast} {
+			for _, credit := range credits {
+				known = known && existing[credit.PersonID]
+			}
+		}
+
+		if !known {
+			report.addError(row.row, map[string]string{"credits": "must only reference existing people"})
+			continue
+		}
+
+		valid = append(valid, row)
+	}
+
+	return valid, nil
+}
+
+// checkImportExternalIDs reports the rows whose external ids are already linked
+// to a movie, or to a movie of an earlier row, and returns the remaining rows.
+// seen holds the external ids of the earlier rows, and gets those of the
+// remaining rows added.
+func (app *application) checkImportExternalIDs(rows []importRow, seen map[string]map[string]bool, report *importReport) ([]importRow, error) {
+	ids := make([]data.ExternalIDs, len(rows))
+
+	for i, row := range rows {
+		ids[i] = row.movie.ExternalIDs
+	}
+
+	linked, err := app.models.Movie.GetLinkedExternalIDs(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := rows[:0]
+
+	for _, row := range rows {
+		rowErrors := map[string]string{}
+
+		for source, externalID := range row.movie.ExternalIDs {
+			switch {
+			case linked[source][externalID]:
+				rowErrors["external_ids"] = "must not be linked to another movie"
+			case seen[source][externalID]:
+				rowErrors["external_ids"] = "must not be linked to the movie of another row"
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			report.addError(row.row, rowErrors)
+			continue
+		}
+
+		for source, externalID := range row.movie.ExternalIDs {
+			if seen[source] == nil {
+				seen[source] = make(map[string]bool)
+			}
+
+			seen[source][externalID] = true
+		}
+
+		valid = append(valid, row)
+	}
+
+	return valid, nil
+}
+
+// readCSVMovies reads the header of a CSV import and returns a function that
+// reads the following rows one at a time, until it returns io.EOF. Rows that
+// can't be turned into a movie are returned with their errors instead.
+func (app *application) readCSVMovies(body io.Reader) (func() (int, *data.Movie, map[string]string, error), error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("body must not be empty")
+		}
+		return nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if !validator.In(name, importCSVColumns...) && !validator.In(name, importOptionalCSVColumns...) && !validator.In(name, importIgnoredCSVColumns...) {
+			return nil, fmt.Errorf("CSV header contains unknown column %q", name)
+		}
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("CSV header contains duplicate column %q", name)
+		}
+
+		columns[name] = i
+	}
+
+	for _, name := range importCSVColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header must contain a %q column", name)
+		}
+	}
+
+	row := 0
+
+	return func() (int, *data.Movie, map[string]string, error) {
+		record, err := reader.Read()
+		row++
+
+		var parseError *csv.ParseError
+
+		switch {
+		case errors.As(err, &parseError) && errors.Is(parseError.Err, csv.ErrFieldCount):
+			return row, nil, map[string]string{"row": fmt.Sprintf("must have %d fields", len(header))}, nil
+		case errors.Is(err, io.EOF):
+			return row, nil, nil, io.EOF
+		case err != nil:
+			return row, nil, nil, fmt.Errorf("body contains badly-formed CSV: %w", err)
+		}
+
+		rowErrors := map[string]string{}
+
+		movie := &data.Movie{
+			Title:  record[columns["title"]],
+			Genres: []string{},
+		}
+
+		year, err := strconv.ParseInt(strings.TrimSpace(record[columns["year"]]), 10, 32)
+		if err != nil {
+			rowErrors["year"] = "must be an integer value"
+		}
+		movie.Year = int32(year)
+
+		runtime := strings.TrimSpace(record[columns["runtime"]])
+
+		if minutes, err := strconv.ParseInt(runtime, 10, 32); err == nil {
+			movie.Runtime = data.Runtime(minutes)
+		} else if movie.Runtime, err = data.ParseRuntime(runtime); err != nil {
+			rowErrors["runtime"] = `must be a number of minutes or in the "<runtime> mins" format`
+		}
+
+		if genres := strings.TrimSpace(record[columns["genres"]]); genres != "" {
+			movie.Genres = strings.Split(genres, "|")
+		}
+
+		if i, ok := columns["poster_url"]; ok {
+			movie.PosterURL = strings.TrimSpace(record[i])
+		}
+
+		if i, ok := columns["backdrop_url"]; ok {
+			movie.BackdropURL = strings.TrimSpace(record[i])
+		}
+
+		movie.ExternalIDs = readCSVObject(record, columns, "external_ids", rowErrors)
+		movie.PosterThumbnails = readCSVObject(record, columns, "poster_thumbnails", rowErrors)
+		movie.BackdropThumbnails = readCSVObject(record, columns, "backdrop_thumbnails", rowErrors)
+
+		if len(rowErrors) > 0 {
+			return row, nil, rowErrors, nil
+		}
+
+		return row, movie, nil, nil
+	}, nil
+}
+
+// readCSVObject decodes the JSON object in the named column of a CSV record,
+// and records an error when it isn't one. It returns nil when the record has no
+// such column or the field is empty.
+func readCSVObject(record []string, columns map[string]int, name string, rowErrors map[string]string) map[string]string {
+	i, ok := columns[name]
+	if !ok {
+		return nil
+	}
+
+	field := strings.TrimSpace(record[i])
+	if field == "" {
+		return nil
+	}
+
+	var object map[string]string
+
+	if err := json.Unmarshal([]byte(field), &object); err != nil {
+		rowErrors[name] = "must be a JSON object of strings"
+	}
+
+	return object
+}
+
+// readNDJSONMovies returns a function that reads the movies of a
+// newline-delimited JSON import one line at a time, until it returns io.EOF.
+// Blank lines are skipped but still counted towards the row numbers. Lines that
+// can't be decoded into a movie are returned with their errors instead.
+func (app *application) readNDJSONMovies(body io.Reader) func() (int, *data.Movie, map[string]string, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxImportRowBytes)
+
+	row := 0
+
+	return func() (int, *data.Movie, map[string]string, error) {
+		for scanner.Scan() {
+			row++
+
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var input struct {
+				Title              string           `json:"title"`
+				Year               int32            `json:"year"`
+				Runtime            data.Runtime     `json:"runtime"`
+				Genres             []string         `json:"genres"`
+				Directors          []data.Credit    `json:"directors"`
+				Cast               []data.Credit    `json:"cast"`
+				ExternalIDs        data.ExternalIDs `json:"external_ids"`
+				PosterURL          string           `json:"poster_url"`
+				PosterThumbnails   data.ImageURLs   `json:"poster_thumbnails"`
+				BackdropURL        string           `json:"backdrop_url"`
+				BackdropThumbnails data.ImageURLs   `json:"backdrop_thumbnails"`
+
+				// The fields an NDJSON export has that are set by the server
+				// are accepted, and ignored.
+				ID            json.RawMessage `json:"id"`
+				CreatedAt     json.RawMessage `json:"created_at"`
+				AverageRating json.RawMessage `json:"average_rating"`
+				RatingCount   json.RawMessage `json:"rating_count"`
+				Version       json.RawMessage `json:"version"`
+			}
+
+			dec := json.NewDecoder(bytes.NewReader(line))
+			dec.DisallowUnknownFields()
+
+			err := dec.Decode(&input)
+			if err == nil && dec.More() {
+				err = errors.New("line must only contain a single JSON value")
+			}
+			if err != nil {
+				return row, nil, map[string]string{"row": fmt.Sprintf("must be a JSON movie object: %s", err)}, nil
+			}
+
+			return row, &data.Movie{
+				Title:              input.Title,
+				Year:               input.Year,
+				Runtime:            input.Runtime,
+				Genres:             input.Genres,
+				Directors:          input.Directors,
+				Cast:               input.Cast,
+				ExternalIDs:        input.ExternalIDs,
+				PosterURL:          input.PosterURL,
+				PosterThumbnails:   input.PosterThumbnails,
+				BackdropURL:        input.BackdropURL,
+				BackdropThumbnails: input.BackdropThumbnails,
+			}, nil, nil
+		}
+
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return row, nil, nil, fmt.Errorf("line %d must not be larger than %d bytes", row+1, maxImportRowBytes)
+			}
+			return row, nil, nil, err
+		}
+
+		return row, nil, nil, io.EOF
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"expvar"
+	"fmt"
 	"os"
 	"runtime"
 	"sync"
@@ -13,6 +14,8 @@ import (
 	"greenlight.nesty.net/internal/data"
 	"greenlight.nesty.net/internal/jsonlog"
 	"greenlight.nesty.net/internal/mailer"
+	"greenlight.nesty.net/internal/storage"
+	"greenlight.nesty.net/internal/validator"
 )
 
 
@@ -21,7 +24,10 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	store  storage.Store
+	stats  *statsCache
 	wg     sync.WaitGroup
+	done   chan struct{}
 }
 
 func main() {
@@ -29,6 +35,10 @@ func main() {
 	cnf.New()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	if !validator.In(cnf.search.language, data.SearchLanguages...) {
+		logger.PrintFatal(fmt.Errorf("unsupported search language %q", cnf.search.language), nil)
+	}
 	db, err := openDB(cnf)
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -36,6 +46,11 @@ func main() {
 
 	defer db.Close()
 
+	store, err := storage.NewLocal(cnf.storage.dir, cnf.storage.baseURL)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	expvar.NewString("version").Set(version)
 
 	expvar.Publish("goroutines", expvar.Func(func() any {
@@ -54,12 +69,33 @@ func main() {
 		config: cnf,
 		logger: logger,
 		models: data.NewModel(db),
+		store:  store,
+		stats:  newStatsCache(cnf.stats.cacheTTL),
 		mailer: mailer.New(cnf.smtp.port, cnf.smtp.host, cnf.smtp.username, cnf.smtp.password, cnf.smtp.sender), // Corrected line
 		wg:     sync.WaitGroup{},
+		done:   make(chan struct{}),
 	}
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	if cnf.trash.purgeInterval > 0 {
+		app.schedule(cnf.trash.purgeInterval, app.purgeTrash)
+	}
+
+	app.schedule(time.Hour, app.purgeIdempotencyKeys)
+
+	if cnf.similar.refreshInterval > 0 {
+		// Refresh right away too, rather than serving no similar movies until
+		// the first interval is up.
+		app.backgropund(app.refreshSimilarMovies)
+		app.schedule(cnf.similar.refreshInterval, app.refreshSimilarMovies)
+	}
+
+	if cnf.recommendations.refreshInterval > 0 {
+		app.backgropund(app.refreshMovieNeighbors)
+		app.schedule(cnf.recommendations.refreshInterval, app.refreshMovieNeighbors)
+	}
+
 	err = app.server()
 	if err != nil {
 		logger.PrintFatal(err, nil)
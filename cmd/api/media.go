@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/imaging"
+	"greenlight.nesty.net/internal/storage"
+	"greenlight.nesty.net/internal/validator"
+)
+
+const (
+	// maxImageBytes bounds the size of an uploaded image.
+	maxImageBytes = 10 << 20
+	// maxImageDimension bounds the width and height of an uploaded image, so
+	// that a small file can't decode into a huge one.
+	maxImageDimension = 8000
+)
+
+// movieImageSpec describes the images accepted for a kind of movie image, and
+// the widths of the thumbnails generated for them, largest first.
+type movieImageSpec struct {
+	minWidth   int
+	minHeight  int
+	thumbnails []int
+}
+
+var movieImageSpecs = map[string]movieImageSpec{
+	data.ImagePoster:   {minWidth: 300, minHeight: 450, thumbnails: []int{342, 185, 92}},
+	data.ImageBackdrop: {minWidth: 1280, minHeight: 720, thumbnails: []int{1280, 780, 300}},
+}
+
+func (app *application) uploadMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImagePoster)
+}
+
+func (app *application) uploadMovieBackdropHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadMovieImage(w, r, data.ImageBackdrop)
+}
+
+// uploadMovieImage stores the JPEG or PNG image uploaded in the "image" field of
+// a multipart form as the poster or backdrop of a movie, along with its
+// thumbnails.
+func (app *application) uploadMovieImage(w http.ResponseWriter, r *http.Request, kind string) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	movie, err := app.models.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if match := r.Header.Get("If-Match"); match != "" && !app.etagMatches(match, app.movieETag(movie)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	// Leave room for the rest of the multipart form around the image.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImageBytes+1<<20)
+
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		switch {
+		case errors.Is(err, http.ErrMissingFile):
+			app.failedValidationResponse(w, r, map[string]string{"image": "must be provided"})
+		default:
+			app.badRequestResponse(w, r, fmt.Errorf("body must be a multipart form: %w", err))
+		}
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	spec := movieImageSpecs[kind]
+
+	v := validator.New()
+
+	v.Check(len(content) <= maxImageBytes, "image", "must not be larger than 10MB")
+	v.Check(validator.In(http.DetectContentType(content), "image/jpeg", "image/png"), "image", "must be a JPEG or PNG image")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"image": "must be a valid JPEG or PNG image"})
+		return
+	}
+
+	v.Check(config.Width >= spec.minWidth && config.Height >= spec.minHeight, "image", fmt.Sprintf("must be at least %dx%d pixels", spec.minWidth, spec.minHeight))
+	v.Check(config.Width <= maxImageDimension && config.Height <= maxImageDimension, "image", fmt.Sprintf("must not be larger than %dx%d pixels", maxImageDimension, maxImageDimension))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		app.failedValidationResponse(w, r, map[string]string{"image": "must be a valid JPEG or PNG image"})
+		return
+	}
+
+	// Every upload is stored under keys of its own, so that concurrent uploads
+	// never overwrite each other's files and the URLs can be cached forever.
+	// Whichever upload loses the race, or fails, deletes its files again.
+	token := make([]byte, 8)
+
+	_, err = rand.Read(token)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	prefix := fmt.Sprintf("%ss/%d/%s/", kind, movie.ID, hex.EncodeToString(token))
+
+	var keys []string
+	saved := false
+
+	defer func() {
+		if !saved {
+			app.deleteMediaFiles(keys)
+		}
+	}()
+
+	keys = append(keys, prefix+"original")
+
+	err = app.store.Put(prefix+"original", bytes.NewReader(content))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	thumbnails := data.ImageURLs{}
+
+	// Each thumbnail is scaled down from the previous, larger one, which is
+	// much cheaper than going back to the original every time.
+	source := img
+
+	for _, width := range spec.thumbnails {
+		thumbnail := imaging.Resize(source, width)
+
+		var buf bytes.Buffer
+
+		err = jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		key := fmt.Sprintf("%sw%d.jpg", prefix, width)
+		keys = append(keys, key)
+
+		err = app.store.Put(key, &buf)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		thumbnails[fmt.Sprintf("w%d", width)] = app.store.URL(key)
+		source = thumbnail
+	}
+
+	previous := movie.ImageURLs(kind)
+
+	err = app.models.Movie.SetImage(movie, kind, app.store.URL(prefix+"original"), thumbnails, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	saved = true
+
+	app.deleteMediaFiles(app.mediaKeys(previous))
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(movie))
+
+	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mediaKeys maps the URLs of stored files back to their keys, skipping those
+// that aren't served from the store.
+func (app *application) mediaKeys(urls []string) []string {
+	base := app.store.URL("")
+
+	keys := []string{}
+
+	for _, url := range urls {
+		if key, ok := strings.CutPrefix(url, base); ok && key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// deleteMediaFiles removes stored files. Failures are only logged, since a
+// leftover file wastes space but breaks nothing.
+func (app *application) deleteMediaFiles(keys []string) {
+	for _, key := range keys {
+		err := app.store.Delete(key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"key": key})
+		}
+	}
+}
+
+func (app *application) showMediaHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	key := strings.TrimPrefix(params.ByName("path"), "/")
+
+	file, modTime, err := app.store.Open(key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(w, r, path.Base(key), modTime, file)
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"expvar"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,6 +14,7 @@ import (
 	"time"
 
 	"github.com/felixge/httpsnoop"
+	"github.com/julienschmidt/httprouter"
 	"github.com/pascaldekloe/jwt"
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
@@ -188,6 +192,162 @@ func (app *application) requirePermission(next http.HandlerFunc, code string) ht
 	return app.requireActivatedUser(fn)
 }
 
+// staticSegments sends requests whose :id parameter names one of segments to
+// that segment's handler, and everything else to next. httprouter can't route
+// a static path segment alongside a wildcard in the same position, so paths
+// like /v1/movies/autocomplete have to be dispatched from the :id route.
+func (app *application) staticSegments(next http.HandlerFunc, segments map[string]http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+
+		if handler, ok := segments[params.ByName("id")]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// idempotentHeaders are the response headers stored with an idempotency key and
+// sent again when its response is replayed.
+var idempotentHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// idempotent makes retrying a request safe. A request with an Idempotency-Key
+// header claims the key and has its response stored, so that repeating the
+// request with the same key replays that response instead of handling it again.
+// Reusing a key for a different request is rejected, except for anonymous
+// requests, whose keys only match requests with the same body.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1_048_576))
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("body must not be larger than 1048576 bytes"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := sha256.New()
+		fmt.Fprintf(fingerprint, "%s %s\n", r.Method, r.URL.RequestURI())
+		fingerprint.Write(body)
+
+		record := &data.IdempotencyRecord{
+			Key:         key,
+			UserID:      app.contextGetUser(r).ID,
+			RequestPath: r.URL.Path,
+			Fingerprint: fingerprint.Sum(nil),
+		}
+
+		claimed, err := app.models.Idempotency.Begin(record, app.config.idempotency.ttl)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrIdempotencyKeyMismatch):
+				app.idempotencyKeyMismatchResponse(w, r)
+			case errors.Is(err, data.ErrIdempotencyKeyInUse):
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !claimed {
+			for key, values := range record.Headers {
+				w.Header()[key] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		// Release the key when the request fails on our side, including
+		// panics, so that the client can retry it.
+		completed := false
+		defer func() {
+			if !completed {
+				err := app.models.Idempotency.Release(record)
+				if err != nil {
+					app.logError(r, err)
+				}
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		record.Status = recorder.status
+		record.Headers = map[string][]string{}
+		record.Body = recorder.body.Bytes()
+
+		for _, key := range idempotentHeaders {
+			if values := w.Header().Values(key); len(values) > 0 {
+				record.Headers[key] = values
+			}
+		}
+
+		err = app.models.Idempotency.Complete(record)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+
+		completed = true
+	}
+}
+
+// responseRecorder passes a response through to the client while keeping a
+// copy of its status and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// purgeIdempotencyKeys deletes the idempotency keys whose responses are no
+// longer kept for replay.
+func (app *application) purgeIdempotencyKeys() {
+	_, err := app.models.Idempotency.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+	}
+}
+
 func (app *application) metrics(next http.Handler) http.Handler {
 	totalRequestsReceived := expvar.NewInt("total_requests_received")
 	totalResponsesSent := expvar.NewInt("total_responses_sent")
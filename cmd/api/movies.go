@@ -1,45 +1,89 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/jsonpatch"
 	"greenlight.nesty.net/internal/validator"
 )
 
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string       `json: "title"`
-		Year    int32        `json: "year"`
-		Runtime data.Runtime `json: "runtime"`
-		Genres  []string     `json: "genres"`
+		Title       string           `json:"title"`
+		Year        int32            `json:"year"`
+		Runtime     data.Runtime     `json:"runtime"`
+		Genres      []string         `json:"genres"`
+		Directors   []data.Credit    `json:"directors"`
+		Cast        []data.Credit    `json:"cast"`
+		ExternalIDs data.ExternalIDs `json:"external_ids"`
 	}
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
+		return
 	}
 
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:       input.Title,
+		Year:        input.Year,
+		Runtime:     input.Runtime,
+		Genres:      input.Genres,
+		Directors:   input.Directors,
+		Cast:        input.Cast,
+		ExternalIDs: input.ExternalIDs,
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	allowDuplicates := app.readBool(r.URL.Query(), "allow_duplicates", false, v)
+
+	err = app.validateMovie(v, movie, app.models.Genre.EnsureExist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movie.Insert(movie)
+	// Movies sharing an external id are always rejected, while a matching
+	// title and year can be overridden, since remakes often share both.
+	duplicates, err := app.models.Movie.FindDuplicates(movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(duplicates) > 0 && (!allowDuplicates || duplicates[0].Reason == "external_id") {
+		app.duplicateMovieResponse(w, r, duplicates)
+		return
+	}
+
+	err = app.models.Movie.Insert(movie, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownPerson):
+			v.AddError("credits", "must only reference existing people")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be linked to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
 	headers := make(http.Header)
@@ -51,7 +95,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-func (app application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParams(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
@@ -69,7 +113,18 @@ func (app application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, nil)
+	etag := app.movieETag(movie)
+
+	if match := r.Header.Get("If-None-Match"); match != "" && app.etagMatches(match, etag) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -79,6 +134,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	id, err := app.readIDParams(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
 	}
 
 	movie, err := app.models.Movie.Get(id)
@@ -92,71 +148,209 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if r.Header.Get("X-Expected-Version") != "" {
-		if strconv.FormatInt(movie.Version, 32) == r.Header.Get("X-Expected-Version") {
-			app.editConflictResponse(w, r)
+	if match := r.Header.Get("If-Match"); match != "" && !app.etagMatches(match, app.movieETag(movie)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	switch app.readMediaType(r) {
+	case "application/json", "":
+		var input movieInput
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		input.apply(movie)
+	case "application/merge-patch+json", "application/json-patch+json":
+		var patch json.RawMessage
+
+		err = app.readJSON(w, r, &patch)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		err = app.patchMovie(app.readMediaType(r), patch, movie, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
 			return
 		}
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
 
-	var input struct {
-		Title   *string       `json: "title"`
-		Year    *int32        `json: "year"`
-		Runtime *data.Runtime `json: "runtime"`
-		Genres  []string      `json: "genres"`
+	err = app.validateMovie(v, movie, app.models.Genre.EnsureExist)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	err = app.models.Movie.Update(movie, app.contextGetUser(r).ID)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrUnknownPerson):
+			v.AddError("credits", "must only reference existing people")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateExternalID):
+			v.AddError("external_ids", "must not be linked to another movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	if input.Title != nil {
-		movie.Title = *input.Title
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(movie))
+
+	err = app.writeJSON(w, movie, http.StatusOK, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
+}
 
-	if input.Year != nil {
-		movie.Year = *input.Year
+func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
 	}
-	if input.Runtime != nil {
-		movie.Runtime = *input.Runtime
+
+	if match := r.Header.Get("If-Match"); match != "" {
+		movie, err := app.models.Movie.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !app.etagMatches(match, app.movieETag(movie)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
 	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
+
+	err = app.models.Movie.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"message": "movie successfully moved to trash"}, http.StatusOK, nil)
+	if err != nil {
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) listTrashedMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query   data.MovieQuery
+		Filters data.Filters
 	}
 
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	qs := r.URL.Query()
+
+	input.Query = app.readMovieQuery(qs, v)
+	input.Query.Trashed = true
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "title", "year", "deleted_at", "-id", "-title", "-year", "-deleted_at"}
+
+	data.ValidateMovieQuery(v, &input.Query)
+
+	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movie.Update(movie)
+	movies, metadata, err := app.models.Movie.GetAll(input.Query, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"movies": movies, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Movie.Restore(id)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	err = app.writeJSON(w, movie, http.StatusOK, nil)
+	movie, err := app.models.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+func (app *application) purgeMovieHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := app.readIDParams(r)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		app.notFoundResponse(w, r)
+		return
 	}
 
-	err = app.models.Movie.Delete(id)
+	imageURLs, err := app.models.Movie.Purge(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -167,18 +361,18 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"message": "movie successfully deleted"}, http.StatusOK, nil)
+	app.deleteMediaFiles(app.mediaKeys(imageURLs))
+
+	err = app.writeJSON(w, envelope{"message": "movie permanently deleted"}, http.StatusOK, nil)
 	if err != nil {
-		if err != nil {
-			app.serverErrorResponse(w, r, err)
-		}
+		app.serverErrorResponse(w, r, err)
 	}
 }
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string
-		Genres  []string
+		Query   data.MovieQuery
+		Facets  []string
 		Filters data.Filters
 	}
 
@@ -186,31 +380,372 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 
 	qs := r.URL.Query()
 
-	input.Title = app.readString(qs, "title", "")
+	input.Query = app.readMovieQuery(qs, v)
 
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	// The watched filter is relative to the authenticated user, so it's read
+	// here rather than in readMovieQuery.
+	if qs.Has("watched") {
+		watched := app.readBool(qs, "watched", false, v)
+		input.Query.Watched = &watched
+		input.Query.WatchedBy = app.contextGetUser(r).ID
+	}
+
+	input.Facets = app.readCSV(qs, "facets", []string{})
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
 
-	input.Filters.Page = app.readInt(qs, "page", 0, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	input.Filters.PageSize = app.readInt(qs, "page_size", 0, v)
+	// Passing a cursor, even an empty one, switches to keyset pagination.
+	input.Filters.Keyset = qs.Has("cursor")
+	input.Filters.Cursor = qs.Get("cursor")
+
+	input.Filters.SkipTotal = !app.readBool(qs, "include_total", true, v)
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 	// Add the supported sort values for this endpoint to the sort safelist.
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "rating", "relevance", "-id", "-title", "-year", "-runtime", "-rating", "-relevance"}
+
+	data.ValidateMovieQuery(v, &input.Query)
+
+	if strings.Contains(input.Filters.Sort, "relevance") {
+		v.Check(input.Query.Title != "", "sort", "relevance can only be used with a title search")
+	}
+
+	for _, facet := range input.Facets {
+		v.Check(validator.In(facet, data.MovieFacets...), "facets", "invalid facet value")
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
+
+	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, metadata, err := app.models.Movie.GetAll(input.Query, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{"movies": movies, "metadata": metadata}
+
+	if len(input.Facets) > 0 {
+		env["facets"], err = app.models.Movie.GetFacets(input.Query, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, env, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// lookupMovieHandler finds a movie by its id in an upstream catalog, given as
+// a single query string parameter such as ?imdb=tt0111161.
+func (app *application) lookupMovieHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	var source, externalID string
+
+	for _, key := range data.ExternalIDSources {
+		if value := qs.Get(key); value != "" {
+			v.Check(source == "", "source", "must only contain one of "+strings.Join(data.ExternalIDSources, ", "))
+			source, externalID = key, value
+		}
+	}
+
+	v.Check(source != "", "source", "must contain one of "+strings.Join(data.ExternalIDSources, ", "))
 
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movie.GetAll(input.Title, input.Genres, input.Filters)
+	movie, err := app.models.Movie.GetByExternalID(source, externalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", app.movieETag(movie))
+
+	err = app.writeJSON(w, envelope{"movie": movie}, http.StatusOK, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) autocompleteMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	prefix := app.readString(qs, "q", "")
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(prefix != "", "q", "must be provided")
+	v.Check(len(prefix) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.writeJSON(w, envelope{"movies": movies, "metadata": metadata}, http.StatusOK, nil)
+	suggestions, err := app.models.Movie.Autocomplete(prefix, limit)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"suggestions": suggestions}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// validateMovie normalizes the genres of a movie to catalog slugs and checks
+// the movie. When genre auto-creation is enabled, genres missing from the
+// catalog are added to it through ensureGenres instead of failing validation.
+func (app *application) validateMovie(v *validator.Validator, movie *data.Movie, ensureGenres func(slugs []string) error) error {
+	movie.Genres = data.GenreSlugs(movie.Genres)
+
+	if app.config.genres.autoCreate {
+		if data.ValidateMovie(v, movie, nil); !v.Valid() {
+			return nil
+		}
+		return ensureGenres(movie.Genres)
+	}
+
+	knownGenres, err := app.models.Genre.GetSlugs()
+	if err != nil {
+		return err
+	}
+
+	data.ValidateMovie(v, movie, knownGenres)
+
+	return nil
+}
+
+// movieInput holds the movie fields a partial update can set. Fields missing
+// from the request are left nil and keep their current value.
+type movieInput struct {
+	Title       *string          `json:"title"`
+	Year        *int32           `json:"year"`
+	Runtime     *data.Runtime    `json:"runtime"`
+	Genres      []string         `json:"genres"`
+	Directors   []data.Credit    `json:"directors"`
+	Cast        []data.Credit    `json:"cast"`
+	ExternalIDs data.ExternalIDs `json:"external_ids"`
+}
+
+func (input *movieInput) apply(movie *data.Movie) {
+	if input.Title != nil {
+		movie.Title = *input.Title
+	}
+	if input.Year != nil {
+		movie.Year = *input.Year
+	}
+	if input.Runtime != nil {
+		movie.Runtime = *input.Runtime
+	}
+	if input.Genres != nil {
+		movie.Genres = input.Genres
+	}
+	if input.Directors != nil {
+		movie.Directors = input.Directors
+	}
+	if input.Cast != nil {
+		movie.Cast = input.Cast
+	}
+	if input.ExternalIDs != nil {
+		movie.ExternalIDs = input.ExternalIDs
+	}
+}
+
+// movieDocument is the part of a movie that JSON Merge Patch and JSON Patch
+// documents are applied to.
+type movieDocument struct {
+	Title       string           `json:"title"`
+	Year        int32            `json:"year"`
+	Runtime     data.Runtime     `json:"runtime"`
+	Genres      []string         `json:"genres"`
+	Directors   []data.Credit    `json:"directors"`
+	Cast        []data.Credit    `json:"cast"`
+	ExternalIDs data.ExternalIDs `json:"external_ids"`
+}
+
+// patchMovie applies a merge patch or JSON Patch, as told by mediaType, to a
+// movie. Patches that can't be applied, or that leave the movie in a shape that
+// can't be decoded, are reported through the validator, keyed by the offending
+// operation or field. The returned error is only for unexpected failures.
+func (app *application) patchMovie(mediaType string, patch json.RawMessage, movie *data.Movie, v *validator.Validator) error {
+	document, err := json.Marshal(&movieDocument{
+		Title:       movie.Title,
+		Year:        movie.Year,
+		Runtime:     movie.Runtime,
+		Genres:      movie.Genres,
+		Directors:   movie.Directors,
+		Cast:        movie.Cast,
+		ExternalIDs: movie.ExternalIDs,
+	})
+	if err != nil {
+		return err
+	}
+
+	var patched []byte
+
+	if mediaType == "application/merge-patch+json" {
+		patched, err = jsonpatch.MergePatch(document, patch)
+		if err != nil {
+			return err
+		}
+	} else {
+		operations, ok := readPatchOperations(patch, v)
+		if !ok {
+			return nil
+		}
+
+		patched, err = jsonpatch.Apply(document, operations)
+		if err != nil {
+			var operationError *jsonpatch.OperationError
+
+			switch {
+			case errors.As(err, &operationError):
+				v.AddError(fmt.Sprintf("patch[%d]", operationError.Index), operationError.Err.Error())
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+
+	var result movieDocument
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&result)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			v.AddError(unmarshalTypeError.Field, "has an incorrect JSON type")
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			v.AddError("runtime", `must be in the "<runtime> mins" format`)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			v.AddError(strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`), "is not a movie field")
+		default:
+			v.AddError("patch", "must produce a JSON object")
+		}
+		return nil
+	}
+
+	// Removing the credits or external ids in a merge patch clears them,
+	// rather than leaving them untouched as a missing field does in a plain
+	// update.
+	if result.Directors == nil {
+		result.Directors = []data.Credit{}
+	}
+	if result.Cast == nil {
+		result.Cast = []data.Credit{}
+	}
+	if result.ExternalIDs == nil {
+		result.ExternalIDs = data.ExternalIDs{}
+	}
+
+	movie.Title = result.Title
+	movie.Year = result.Year
+	movie.Runtime = result.Runtime
+	movie.Genres = result.Genres
+	movie.Directors = result.Directors
+	movie.Cast = result.Cast
+	movie.ExternalIDs = result.ExternalIDs
+
+	return nil
+}
+
+// readPatchOperations decodes a JSON Patch document, reporting the operations
+// that aren't well-formed through the validator.
+func readPatchOperations(patch json.RawMessage, v *validator.Validator) ([]jsonpatch.Operation, bool) {
+	var elements []json.RawMessage
+
+	err := json.Unmarshal(patch, &elements)
+	if err != nil {
+		v.AddError("patch", "must be an array of operations")
+		return nil, false
+	}
+
+	operations := make([]jsonpatch.Operation, len(elements))
+
+	for i, element := range elements {
+		dec := json.NewDecoder(bytes.NewReader(element))
+		dec.DisallowUnknownFields()
+
+		err := dec.Decode(&operations[i])
+		if err != nil {
+			var unmarshalTypeError *json.UnmarshalTypeError
+
+			switch {
+			case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+				v.AddError(fmt.Sprintf("patch[%d].%s", i, unmarshalTypeError.Field), "has an incorrect JSON type")
+			case strings.HasPrefix(err.Error(), "json: unknown field "):
+				v.AddError(fmt.Sprintf("patch[%d].%s", i, strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)), "is not an operation field")
+			default:
+				v.AddError(fmt.Sprintf("patch[%d]", i), "must be an operation object")
+			}
+		}
+	}
+
+	return operations, v.Valid()
+}
+
+// readMovieQuery reads the movie filtering criteria shared by every endpoint
+// that lists movies from the query string.
+func (app *application) readMovieQuery(qs url.Values, v *validator.Validator) data.MovieQuery {
+	return data.MovieQuery{
+		Title:         app.readString(qs, "title", ""),
+		Language:      app.readString(qs, "language", app.config.search.language),
+		Fuzzy:         app.readBool(qs, "fuzzy", false, v),
+		Genres:        data.GenreSlugs(app.readCSV(qs, "genres", []string{})),
+		GenresAny:     data.GenreSlugs(app.readCSV(qs, "genres_any", []string{})),
+		YearMin:       int32(app.readInt(qs, "year_min", 0, v)),
+		YearMax:       int32(app.readInt(qs, "year_max", 0, v)),
+		RuntimeMin:    app.readRuntime(qs, "runtime_min", 0, v),
+		RuntimeMax:    app.readRuntime(qs, "runtime_max", 0, v),
+		CreatedAfter:  app.readTime(qs, "created_after", time.Time{}, v),
+		CreatedBefore: app.readTime(qs, "created_before", time.Time{}, v),
+	}
+}
+
+// purgeTrash permanently deletes the movies that have been in the trash for
+// longer than the configured retention, along with their image files.
+func (app *application) purgeTrash() {
+	purged, imageURLs, err := app.models.Movie.PurgeTrash(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	app.deleteMediaFiles(app.mediaKeys(imageURLs))
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged trashed movies", map[string]string{
+			"count": strconv.FormatInt(purged, 10),
+		})
 	}
 }
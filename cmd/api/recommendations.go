@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// listRecommendationsHandler lists the movies recommended to the authenticated
+// user from the movies they watched and rated well. Users without enough
+// history get popular movies instead, optionally in the given genres, and the
+// source of the recommendations tells the two apart.
+func (app *application) listRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Genres  []string
+		Filters data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Genres = data.GenreSlugs(app.readCSV(qs, "genres", []string{}))
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// Recommendations always come best first.
+	input.Filters.Sort = "-score"
+	input.Filters.SortSafelist = []string{"-score"}
+
+	v.Check(len(input.Genres) <= 20, "genres", "must not contain more than 20")
+
+	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recommendations, source, metadata, err := app.models.Recommendation.GetForUser(app.contextGetUser(r).ID, input.Genres, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"recommendations": recommendations, "source": source, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshMovieNeighbors recomputes the neighbors personal recommendations are
+// built from.
+func (app *application) refreshMovieNeighbors() {
+	app.refreshMovieBatches("refreshed movie neighbors", app.models.Recommendation.RefreshNeighbors)
+}
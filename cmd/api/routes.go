@@ -17,15 +17,72 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission(app.listMoviesHandler, "movies:read"))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(app.createMovieHandler, "movies:write"))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission(app.showMovieHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission(app.idempotent(app.createMovieHandler), "movies:write"))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticSegments(app.requirePermission(app.showMovieHandler, "movies:read"), map[string]http.HandlerFunc{
+		"autocomplete": app.requirePermission(app.autocompleteMoviesHandler, "movies:read"),
+		"trash":        app.requirePermission(app.listTrashedMoviesHandler, "movies:write"),
+		"export":       app.requirePermission(app.exportMoviesHandler, "movies:read"),
+		"lookup":       app.requirePermission(app.lookupMovieHandler, "movies:read"),
+	}))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticSegments(app.methodNotAllowedResponse, map[string]http.HandlerFunc{
+		"import": app.requirePermission(app.importMoviesHandler, "movies:write"),
+		"batch":  app.requirePermission(app.batchMoviesHandler, "movies:write"),
+	}))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission(app.updateMovieHandler, "movies:write"))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission(app.deleteMovieHandler, "movies:write"))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission(app.uploadMoviePosterHandler, "movies:write"))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/backdrop", app.requirePermission(app.uploadMovieBackdropHandler, "movies:write"))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission(app.restoreMovieHandler, "movies:write"))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/purge", app.requirePermission(app.purgeMovieHandler, "movies:purge"))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission(app.listSimilarMoviesHandler, "movies:read"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions", app.requirePermission(app.listMovieRevisionsHandler, "movies:read"))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/revisions/:version", app.requirePermission(app.showMovieRevisionHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revisions/:version/restore", app.requirePermission(app.restoreMovieRevisionHandler, "movies:write"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requirePermission(app.listReviewsHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireActivatedUser(app.createReviewHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.updateReviewHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requireActivatedUser(app.deleteReviewHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/watched", app.requireActivatedUser(app.markMovieWatchedHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/watched", app.requireActivatedUser(app.unmarkMovieWatchedHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requirePermission(app.listGenresHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPost, "/v1/genres", app.requirePermission(app.createGenreHandler, "genres:write"))
+	router.HandlerFunc(http.MethodGet, "/v1/genres/:id", app.requirePermission(app.showGenreHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPatch, "/v1/genres/:id", app.requirePermission(app.updateGenreHandler, "genres:write"))
+	router.HandlerFunc(http.MethodDelete, "/v1/genres/:id", app.requirePermission(app.deleteGenreHandler, "genres:write"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requirePermission(app.listPeopleHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requirePermission(app.createPersonHandler, "movies:write"))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requirePermission(app.showPersonHandler, "movies:read"))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requirePermission(app.updatePersonHandler, "movies:write"))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requirePermission(app.deletePersonHandler, "movies:write"))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id/movies", app.requirePermission(app.listPersonMoviesHandler, "movies:read"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission(app.showMovieStatsHandler, "movies:read"))
+
+	router.HandlerFunc(http.MethodGet, "/v1/media/*path", app.showMediaHandler)
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(app.registerUserHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/history", app.requireActivatedUser(app.listWatchHistoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/recommendations", app.requireActivatedUser(app.listRecommendationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/lists", app.requireActivatedUser(app.listMyListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/lists", app.requireActivatedUser(app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/lists/:list_id", app.requireActivatedUser(app.showMyListHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/lists/:list_id", app.requireActivatedUser(app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/lists/:list_id", app.requireActivatedUser(app.deleteListHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/lists/:list_id/items", app.requireActivatedUser(app.addListItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/lists/:list_id/items/:movie_id", app.requireActivatedUser(app.moveListItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/lists/:list_id/items/:movie_id", app.requireActivatedUser(app.removeListItemHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.showListHandler)
+
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthentidcationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
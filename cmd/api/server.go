@@ -45,6 +45,7 @@ func (app *application) server() error {
 			"addr": srv.Addr,
 		})
 
+		close(app.done)
 		app.wg.Wait()
 		shutdwonError <- nil
 	}()
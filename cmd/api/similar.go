@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// movieRefreshBatchSize is the number of movies whose similar movies or
+// neighbors are recomputed in a single transaction.
+const movieRefreshBatchSize = 200
+
+// listSimilarMoviesHandler lists the movies most similar to a movie, as of the
+// last similarity refresh. Movies added since then have none yet.
+func (app *application) listSimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParams(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Filters data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-score")
+	input.Filters.SortSafelist = []string{"score", "title", "year", "-score", "-title", "-year"}
+
+	if data.ValidateFilters(v, &input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Movie.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	similar, metadata, err := app.models.Movie.GetSimilar(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, envelope{"similar": similar, "metadata": metadata}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshSimilarMovies recomputes the similar movies of every movie.
+func (app *application) refreshSimilarMovies() {
+	app.refreshMovieBatches("refreshed similar movies", app.models.Movie.RefreshSimilar)
+}
+
+// refreshMovieBatches runs refresh over every movie, one batch at a time so
+// that no transaction runs for long, and logs message once it's done. It gives
+// up between batches when the server shuts down.
+func (app *application) refreshMovieBatches(message string, refresh func(afterID int64, limit int) (int64, error)) {
+	start := time.Now()
+
+	var afterID int64
+	batches := 0
+
+	for {
+		select {
+		case <-app.done:
+			return
+		default:
+		}
+
+		lastID, err := refresh(afterID, movieRefreshBatchSize)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"after_id": strconv.FormatInt(afterID, 10),
+			})
+			return
+		}
+
+		if lastID == 0 {
+			break
+		}
+
+		afterID = lastID
+		batches++
+	}
+
+	app.logger.PrintInfo(message, map[string]string{
+		"batches":  strconv.Itoa(batches),
+		"duration": time.Since(start).String(),
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// maxStatsCacheEntries bounds the number of filter combinations whose stats are
+// cached at once.
+const maxStatsCacheEntries = 256
+
+// statsCache keeps movie stats for ttl, keyed by the query they were computed
+// for. A zero ttl disables it.
+type statsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]statsCacheEntry
+}
+
+type statsCacheEntry struct {
+	stats   *data.MovieStats
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{
+		ttl:     ttl,
+		entries: make(map[string]statsCacheEntry),
+	}
+}
+
+func (cache *statsCache) get(key string) (*data.MovieStats, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.stats, true
+}
+
+func (cache *statsCache) set(key string, stats *data.MovieStats) {
+	if cache.ttl <= 0 {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if len(cache.entries) >= maxStatsCacheEntries {
+		now := time.Now()
+
+		for key, entry := range cache.entries {
+			if now.After(entry.expires) {
+				delete(cache.entries, key)
+			}
+		}
+
+		// Still full of live entries, so start over rather than track which
+		// of them is the least useful.
+		if len(cache.entries) >= maxStatsCacheEntries {
+			clear(cache.entries)
+		}
+	}
+
+	cache.entries[key] = statsCacheEntry{stats: stats, expires: time.Now().Add(cache.ttl)}
+}
+
+// statsCacheKey identifies the movies a query matches. Genres are sorted, since
+// their order doesn't change the matches, and times are compared in UTC. The
+// watched filter isn't part of it, as stats don't support it.
+func statsCacheKey(query data.MovieQuery) (string, error) {
+	key := struct {
+		Title         string    `json:"title"`
+		Language      string    `json:"language"`
+		Fuzzy         bool      `json:"fuzzy"`
+		Genres        []string  `json:"genres"`
+		GenresAny     []string  `json:"genres_any"`
+		YearMin       int32     `json:"year_min"`
+		YearMax       int32     `json:"year_max"`
+		RuntimeMin    int32     `json:"runtime_min"`
+		RuntimeMax    int32     `json:"runtime_max"`
+		CreatedAfter  time.Time `json:"created_after"`
+		CreatedBefore time.Time `json:"created_before"`
+		Trashed       bool      `json:"trashed"`
+	}{
+		Title:         query.Title,
+		Language:      query.Language,
+		Fuzzy:         query.Fuzzy,
+		Genres:        slices.Sorted(slices.Values(query.Genres)),
+		GenresAny:     slices.Sorted(slices.Values(query.GenresAny)),
+		YearMin:       query.YearMin,
+		YearMax:       query.YearMax,
+		RuntimeMin:    int32(query.RuntimeMin),
+		RuntimeMax:    int32(query.RuntimeMax),
+		CreatedAfter:  query.CreatedAfter.UTC(),
+		CreatedBefore: query.CreatedBefore.UTC(),
+		Trashed:       query.Trashed,
+	}
+
+	js, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(js), nil
+}
+
+// showMovieStatsHandler responds with aggregates over the movies matching the
+// same filters as the movies listing, except for watched: stats are shared by
+// every user, so they can't be narrowed down to what one of them watched.
+// Stats are cached per filter combination, and generated_at tells how fresh
+// they are.
+func (app *application) showMovieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	query := app.readMovieQuery(r.URL.Query(), v)
+
+	if data.ValidateMovieQuery(v, &query); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key, err := statsCacheKey(query)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	stats, ok := app.stats.get(key)
+	if !ok {
+		stats, err = app.models.Movie.GetStats(query)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.stats.set(key, stats)
+	}
+
+	err = app.writeJSON(w, envelope{"stats": stats}, http.StatusOK, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"greenlight.nesty.net/internal/data"
+)
+
+func TestStatsCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		expired bool
+		wantHit bool
+	}{
+		{"fresh entry", time.Minute, false, true},
+		{"expired entry", time.Minute, true, false},
+		{"disabled cache", 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newStatsCache(tt.ttl)
+			stats := &data.MovieStats{}
+
+			cache.set("key", stats)
+
+			if tt.expired {
+				entry := cache.entries["key"]
+				entry.expires = time.Now().Add(-time.Second)
+				cache.entries["key"] = entry
+			}
+
+			got, ok := cache.get("key")
+			if ok != tt.wantHit {
+				t.Fatalf("got hit %t; want %t", ok, tt.wantHit)
+			}
+
+			if ok && got != stats {
+				t.Errorf("got stats %p; want %p", got, stats)
+			}
+
+			if _, ok := cache.get("other"); ok {
+				t.Error("got a hit for a key that was never set")
+			}
+		})
+	}
+}
+
+func TestStatsCacheEviction(t *testing.T) {
+	tests := []struct {
+		name        string
+		expired     int
+		wantEntries int
+	}{
+		{"evicts expired entries first", 10, maxStatsCacheEntries - 10 + 1},
+		{"clears a cache full of live entries", 0, 1},
+		{"clears when every entry expired", maxStatsCacheEntries, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := newStatsCache(time.Minute)
+
+			for i := 0; i < maxStatsCacheEntries; i++ {
+				cache.set(strconv.Itoa(i), &data.MovieStats{})
+			}
+
+			for i := 0; i < tt.expired; i++ {
+				key := strconv.Itoa(i)
+
+				entry := cache.entries[key]
+				entry.expires = time.Now().Add(-time.Second)
+				cache.entries[key] = entry
+			}
+
+			cache.set("new", &data.MovieStats{})
+
+			if got := len(cache.entries); got != tt.wantEntries {
+				t.Errorf("got %d entries; want %d", got, tt.wantEntries)
+			}
+
+			if _, ok := cache.get("new"); !ok {
+				t.Error("the entry just set is missing")
+			}
+
+			if tt.expired > 0 && tt.expired < maxStatsCacheEntries {
+				if _, ok := cache.get(strconv.Itoa(maxStatsCacheEntries - 1)); !ok {
+					t.Error("a live entry was evicted")
+				}
+			}
+		})
+	}
+}
+
+func TestStatsCacheKey(t *testing.T) {
+	base := data.MovieQuery{
+		Title:        "heat",
+		Language:     "english",
+		Genres:       []string{"crime", "drama"},
+		YearMin:      1990,
+		CreatedAfter: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	watched := true
+
+	tests := []struct {
+		name     string
+		modify   func(query *data.MovieQuery)
+		wantSame bool
+	}{
+		{"same query", func(query *data.MovieQuery) {}, true},
+		{"genres in another order", func(query *data.MovieQuery) { query.Genres = []string{"drama", "crime"} }, true},
+		{"same instant in another zone", func(query *data.MovieQuery) {
+			query.CreatedAfter = query.CreatedAfter.In(time.FixedZone("CET", 3600))
+		}, true},
+		{"watched filter", func(query *data.MovieQuery) { query.Watched, query.WatchedBy = &watched, 1 }, true},
+		{"another title", func(query *data.MovieQuery) { query.Title = "alien" }, false},
+		{"another genre", func(query *data.MovieQuery) { query.Genres = []string{"crime"} }, false},
+		{"genres matched by any", func(query *data.MovieQuery) { query.Genres, query.GenresAny = nil, query.Genres }, false},
+		{"another year", func(query *data.MovieQuery) { query.YearMin = 1991 }, false},
+		{"another runtime", func(query *data.MovieQuery) { query.RuntimeMax = 120 }, false},
+		{"fuzzy search", func(query *data.MovieQuery) { query.Fuzzy = true }, false},
+		{"another instant", func(query *data.MovieQuery) { query.CreatedAfter = query.CreatedAfter.Add(time.Second) }, false},
+	}
+
+	want, err := statsCacheKey(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := base
+			query.Genres = append([]string(nil), base.Genres...)
+			tt.modify(&query)
+
+			got, err := statsCacheKey(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (got == want) != tt.wantSame {
+				t.Errorf("got key %s for %s; same as %s is %t, want %t", got, tt.name, want, got == want, tt.wantSame)
+			}
+		})
+	}
+}
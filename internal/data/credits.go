@@ -0,0 +1,242 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+const (
+	CreditDirector = "director"
+	CreditCast     = "cast"
+)
+
+var ErrUnknownPerson = errors.New("unknown person")
+
+type Credit struct {
+	PersonID     int64  `json:"person_id"`
+	Name         string `json:"name,omitempty"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int32  `json:"billing_order,omitempty"`
+}
+
+// getMovieCredits loads the directors and cast of a movie, ordered by billing.
+func getMovieCredits(ctx context.Context, db queryer, movie *Movie) error {
+	query := `
+        SELECT movie_credits.role, movie_credits.person_id, people.name, movie_credits.character, movie_credits.billing_order
+        FROM movie_credits
+        INNER JOIN people ON people.id = movie_credits.person_id
+        WHERE movie_credits.movie_id = $1
+        ORDER BY movie_credits.billing_order ASC, people.name ASC`
+
+	rows, err := db.QueryContext(ctx, query, movie.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	movie.Directors = []Credit{}
+	movie.Cast = []Credit{}
+
+	for rows.Next() {
+		var role string
+		var credit Credit
+
+		err := rows.Scan(&role, &credit.PersonID, &credit.Name, &credit.Character, &credit.BillingOrder)
+		if err != nil {
+			return err
+		}
+
+		switch role {
+		case CreditDirector:
+			movie.Directors = append(movie.Directors, credit)
+		case CreditCast:
+			movie.Cast = append(movie.Cast, credit)
+		}
+	}
+
+	return rows.Err()
+}
+
+// setMovieCredits replaces the credits of a movie for every role whose slice
+// is non-nil. A nil slice leaves the stored credits for that role untouched.
+func setMovieCredits(ctx context.Context, tx queryer, movie *Movie) error {
+	roles := []struct {
+		name    string
+		credits []Credit
+	}{
+		{CreditDirector, movie.Directors},
+		{CreditCast, movie.Cast},
+	}
+
+	for _, role := range roles {
+		if role.credits == nil {
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx, `DELETE FROM movie_credits WHERE movie_id = $1 AND role = $2`, movie.ID, role.name)
+		if err != nil {
+			return err
+		}
+
+		for i := range role.credits {
+			credit := &role.credits[i]
+
+			if credit.BillingOrder == 0 {
+				credit.BillingOrder = int32(i + 1)
+			}
+
+			query := `
+                INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+                VALUES ($1, $2, $3, $4, $5)
+                RETURNING (SELECT name FROM people WHERE people.id = person_id)`
+
+			args := []any{movie.ID, credit.PersonID, role.name, credit.Character, credit.BillingOrder}
+
+			err := tx.QueryRowContext(ctx, query, args...).Scan(&credit.Name)
+			if err != nil {
+				return creditInsertError(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// insertCreditBatch inserts the credits of newly inserted movies with a single
+// statement and fills in the names of the credited people. Movies without
+// credits get empty ones, and the credits of each movie end up ordered by
+// billing, the way getMovieCredits loads them.
+func insertCreditBatch(ctx context.Context, db queryer, movies []*Movie) error {
+	type creditKey struct {
+		movieID  int64
+		personID int64
+		role     string
+	}
+
+	var movieIDs, personIDs []int64
+	var roleNames, characters []string
+	var billingOrders []int32
+
+	credits := make(map[creditKey]*Credit)
+
+	for _, movie := range movies {
+		if movie.Directors == nil {
+			movie.Directors = []Credit{}
+		}
+		if movie.Cast == nil {
+			movie.Cast = []Credit{}
+		}
+
+		roles := []struct {
+			name    string
+			credits []Credit
+		}{
+			{CreditDirector, movie.Directors},
+			{CreditCast, movie.Cast},
+		}
+
+		for _, role := range roles {
+			for i := range role.credits {
+				credit := &role.credits[i]
+
+				if credit.BillingOrder == 0 {
+					credit.BillingOrder = int32(i + 1)
+				}
+
+				movieIDs = append(movieIDs, movie.ID)
+				personIDs = append(personIDs, credit.PersonID)
+				roleNames = append(roleNames, role.name)
+				characters = append(characters, credit.Character)
+				billingOrders = append(billingOrders, credit.BillingOrder)
+
+				credits[creditKey{movie.ID, credit.PersonID, role.name}] = credit
+			}
+		}
+	}
+
+	if len(movieIDs) == 0 {
+		return nil
+	}
+
+	query := `
+        INSERT INTO movie_credits (movie_id, person_id, role, character, billing_order)
+        SELECT * FROM unnest($1::bigint[], $2::bigint[], $3::text[], $4::text[], $5::integer[])
+        RETURNING movie_id, person_id, role, (SELECT name FROM people WHERE people.id = person_id)`
+
+	args := []any{pq.Array(movieIDs), pq.Array(personIDs), pq.Array(roleNames), pq.Array(characters), pq.Array(billingOrders)}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return creditInsertError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key creditKey
+		var name string
+
+		err := rows.Scan(&key.movieID, &key.personID, &key.role, &name)
+		if err != nil {
+			return err
+		}
+
+		credit, ok := credits[key]
+		if !ok {
+			return fmt.Errorf("insert returned unknown credit of person %d for movie %d", key.personID, key.movieID)
+		}
+
+		credit.Name = name
+	}
+
+	// The foreign keys are only checked once every row has been returned.
+	if err = rows.Err(); err != nil {
+		return creditInsertError(err)
+	}
+
+	for _, movie := range movies {
+		for _, roleCredits := range [][]Credit{movie.Directors, movie.Cast} {
+			sort.SliceStable(roleCredits, func(i, j int) bool {
+				if roleCredits[i].BillingOrder != roleCredits[j].BillingOrder {
+					return roleCredits[i].BillingOrder < roleCredits[j].BillingOrder
+				}
+				return roleCredits[i].Name < roleCredits[j].Name
+			})
+		}
+	}
+
+	return nil
+}
+
+// creditInsertError turns the error of a credit insert referencing a person
+// that doesn't exist into ErrUnknownPerson.
+func creditInsertError(err error) error {
+	switch {
+	case err.Error() == `pq: insert or update on table "movie_credits" violates foreign key constraint "movie_credits_person_id_fkey"`:
+		return ErrUnknownPerson
+	default:
+		return err
+	}
+}
+
+func validateCredits(v *validator.Validator, key string, credits []Credit) {
+	seen := make(map[int64]bool, len(credits))
+
+	for i, credit := range credits {
+		field := key + "." + strconv.Itoa(i)
+
+		v.Check(credit.PersonID > 0, field+".person_id", "must be a valid person id")
+		v.Check(!seen[credit.PersonID], field+".person_id", "must not be listed more than once")
+		v.Check(len(credit.Character) <= 500, field+".character", "must not be more than 500 bytes long")
+		v.Check(credit.BillingOrder >= 0, field+".billing_order", "must not be negative")
+
+		seen[credit.PersonID] = true
+	}
+
+	v.Check(len(credits) <= 200, key, "must not contain more than 200 entries")
+}
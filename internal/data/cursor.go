@@ -0,0 +1,85 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor marks a position in a keyset-paginated listing. It holds the values of
+// the sort columns and the id of the row it points at, along with the sort the
+// listing was using, so a cursor can't be replayed against a different order.
+type cursor struct {
+	Sort     string   `json:"s"`
+	Values   []string `json:"v"`
+	ID       int64    `json:"i"`
+	Backward bool     `json:"b,omitempty"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+
+	err = json.Unmarshal(js, &c)
+	if err != nil || c.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// addKeysetCondition restricts the listing to the rows that follow the cursor
+// in the listing's order, or precede it for a backward cursor. For a sort list
+// (a, b) that's a > $1 OR (a = $1 AND b > $2) OR (a = $1 AND b = $2 AND id > $3),
+// with the comparisons flipped for descending columns.
+func (filter *Filters) addKeysetCondition(where *whereClause, columns map[string]string) {
+	fields := filter.sortFields(columns)
+	fields = append(fields, sortField{column: tiebreaker(columns), direction: "ASC"})
+
+	args := make([]any, 0, len(fields))
+	for _, value := range filter.cursor.Values {
+		args = append(args, value)
+	}
+	args = append(args, filter.cursor.ID)
+
+	var alternatives []string
+	var equalities []string
+
+	for i, field := range fields {
+		op := ">"
+		if field.direction == "DESC" {
+			op = "<"
+		}
+		if filter.cursor.Backward {
+			op = flipComparison(op)
+		}
+
+		terms := append(slices.Clone(equalities), fmt.Sprintf("%s %s $%%[%d]d", field.column, op, i+1))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+
+		equalities = append(equalities, fmt.Sprintf("%s = $%%[%d]d", field.column, i+1))
+	}
+
+	where.add("("+strings.Join(alternatives, " OR ")+")", args...)
+}
+
+func flipComparison(op string) string {
+	if op == ">" {
+		return "<"
+	}
+	return ">"
+}
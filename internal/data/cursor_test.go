@@ -0,0 +1,225 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor cursor
+	}{
+		{"id only", cursor{Sort: "id", ID: 1}},
+		{"sort values", cursor{Sort: "-year,title", Values: []string{"1999", "Heat"}, ID: 42}},
+		{"backward", cursor{Sort: "title", Values: []string{"Alien"}, ID: 7, Backward: true}},
+		{"values needing escaping", cursor{Sort: "title", Values: []string{`"quoted" / ~ ünïcode`}, ID: 3}},
+		{"empty value", cursor{Sort: "title", Values: []string{""}, ID: 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeCursor(tt.cursor)
+
+			if _, err := base64.RawURLEncoding.DecodeString(encoded); err != nil {
+				t.Fatalf("cursor %q isn't URL-safe base64: %s", encoded, err)
+			}
+
+			got, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(*got, tt.cursor) {
+				t.Errorf("got %+v; want %+v", *got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(js string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(js))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id","i":1}`))},
+		{"not JSON", encode("cursor")},
+		{"wrong types", encode(`{"s":1,"i":"1"}`)},
+		{"missing id", encode(`{"s":"id"}`)},
+		{"negative id", encode(`{"s":"id","i":-1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeCursor(tt.cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("got error %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func TestAddKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		columns  map[string]string
+		cursor   cursor
+		want     string
+		wantArgs []any
+	}{
+		{
+			name:     "single column",
+			sort:     "title",
+			cursor:   cursor{Sort: "title", Values: []string{"Heat"}, ID: 5},
+			want:     "((title > $2) OR (title = $2 AND id > $3))",
+			wantArgs: []any{"TRUE", "Heat", int64(5)},
+		},
+		{
+			name:     "sort list",
+			sort:     "-year,title",
+			cursor:   cursor{Sort: "-year,title", Values: []string{"1999", "Heat"}, ID: 7},
+			want:     "((year < $2) OR (year = $2 AND title > $3) OR (year = $2 AND title = $3 AND id > $4))",
+			wantArgs: []any{"TRUE", "1999", "Heat", int64(7)},
+		},
+		{
+			name:     "backward",
+			sort:     "-year",
+			cursor:   cursor{Sort: "-year", Values: []string{"1999"}, ID: 7, Backward: true},
+			want:     "((year > $2) OR (year = $2 AND id < $3))",
+			wantArgs: []any{"TRUE", "1999", int64(7)},
+		},
+		{
+			name:     "mapped columns",
+			sort:     "-rating",
+			columns:  map[string]string{"rating": "average_rating", "id": "movies.id"},
+			cursor:   cursor{Sort: "-rating", Values: []string{"4.5"}, ID: 9},
+			want:     "((average_rating < $2) OR (average_rating = $2 AND movies.id > $3))",
+			wantArgs: []any{"TRUE", "4.5", int64(9)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{
+				Sort:         tt.sort,
+				SortSafelist: []string{"id", "-year", "title", "-rating"},
+				Keyset:       true,
+				cursor:       &tt.cursor,
+			}
+
+			// A condition added beforehand checks that the placeholders are
+			// numbered after the existing arguments.
+			where := &whereClause{}
+			where.add("$%d", "TRUE")
+
+			filters.addKeysetCondition(where, tt.columns)
+
+			if got := where.conditions[1]; got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+
+			if !reflect.DeepEqual(where.args, tt.wantArgs) {
+				t.Errorf("got args %v; want %v", where.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPaginateKeyset(t *testing.T) {
+	key := func(id int) ([]string, int64) {
+		return []string{strconv.Itoa(id * 10)}, int64(id)
+	}
+
+	tests := []struct {
+		name     string
+		cursor   *cursor
+		rows     []int
+		wantRows []int
+		wantNext *cursor
+		wantPrev *cursor
+	}{
+		{
+			name:     "only page",
+			rows:     []int{1, 2},
+			wantRows: []int{1, 2},
+		},
+		{
+			name:     "first page",
+			rows:     []int{1, 2, 3},
+			wantRows: []int{1, 2},
+			wantNext: &cursor{Sort: "id", Values: []string{"20"}, ID: 2},
+		},
+		{
+			name:     "middle page",
+			cursor:   &cursor{Sort: "id", Values: []string{"20"}, ID: 2},
+			rows:     []int{3, 4, 5},
+			wantRows: []int{3, 4},
+			wantNext: &cursor{Sort: "id", Values: []string{"40"}, ID: 4},
+			wantPrev: &cursor{Sort: "id", Values: []string{"30"}, ID: 3, Backward: true},
+		},
+		{
+			name:     "last page",
+			cursor:   &cursor{Sort: "id", Values: []string{"40"}, ID: 4},
+			rows:     []int{5},
+			wantRows: []int{5},
+			wantPrev: &cursor{Sort: "id", Values: []string{"50"}, ID: 5, Backward: true},
+		},
+		{
+			name:     "backward page",
+			cursor:   &cursor{Sort: "id", Values: []string{"50"}, ID: 5, Backward: true},
+			rows:     []int{4, 3, 2},
+			wantRows: []int{3, 4},
+			wantNext: &cursor{Sort: "id", Values: []string{"40"}, ID: 4},
+			wantPrev: &cursor{Sort: "id", Values: []string{"30"}, ID: 3, Backward: true},
+		},
+		{
+			name:     "backward to the first page",
+			cursor:   &cursor{Sort: "id", Values: []string{"30"}, ID: 3, Backward: true},
+			rows:     []int{2, 1},
+			wantRows: []int{1, 2},
+			wantNext: &cursor{Sort: "id", Values: []string{"20"}, ID: 2},
+		},
+		{
+			name:   "past the end",
+			cursor: &cursor{Sort: "id", Values: []string{"50"}, ID: 5},
+			rows:   []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Sort: "id", PageSize: 2, Keyset: true, cursor: tt.cursor}
+
+			rows, metadata := paginateKeyset(&filters, tt.rows, key)
+
+			if len(rows) != len(tt.wantRows) || (len(rows) > 0 && !reflect.DeepEqual(rows, tt.wantRows)) {
+				t.Errorf("got rows %v; want %v", rows, tt.wantRows)
+			}
+
+			for _, c := range []struct {
+				name string
+				got  string
+				want *cursor
+			}{
+				{"next", metadata.NextCursor, tt.wantNext},
+				{"prev", metadata.PrevCursor, tt.wantPrev},
+			} {
+				switch {
+				case c.want == nil && c.got != "":
+					t.Errorf("got %s cursor %q; want none", c.name, c.got)
+				case c.want != nil && c.got != encodeCursor(*c.want):
+					t.Errorf("got %s cursor %q; want %+v", c.name, c.got, *c.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,289 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+var ErrDuplicateExternalID = errors.New("duplicate external id")
+
+// externalIDFormats maps each upstream catalog a movie can be linked to to the
+// format of its identifiers.
+var externalIDFormats = map[string]*regexp.Regexp{
+	"imdb":     regexp.MustCompile(`^tt\d{7,}$`),
+	"tmdb":     regexp.MustCompile(`^[1-9]\d*$`),
+	"wikidata": regexp.MustCompile(`^Q[1-9]\d*$`),
+}
+
+// ExternalIDSources are the upstream catalogs a movie can be linked to.
+var ExternalIDSources = []string{"imdb", "tmdb", "wikidata"}
+
+// ExternalIDs maps upstream catalogs to the id of a movie in them. It's read as
+// a jsonb object aggregated from the movie_external_ids table.
+type ExternalIDs map[string]string
+
+func (ids *ExternalIDs) Scan(value any) error {
+	if value == nil {
+		*ids = nil
+		return nil
+	}
+
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ExternalIDs", value)
+	}
+
+	return json.Unmarshal(b, ids)
+}
+
+func (ids ExternalIDs) Value() (driver.Value, error) {
+	js, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+// externalIDsColumn selects the external ids of the movies in a query as a
+// jsonb object, or NULL for movies without any.
+const externalIDsColumn = `(SELECT jsonb_object_agg(source, external_id) FROM movie_external_ids WHERE movie_id = movies.id)`
+
+// setMovieExternalIDs replaces the external ids of a movie. A nil map leaves
+// them untouched.
+func setMovieExternalIDs(ctx context.Context, db queryer, movie *Movie) error {
+	if movie.ExternalIDs == nil {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `DELETE FROM movie_external_ids WHERE movie_id = $1`, movie.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO movie_external_ids (movie_id, source, external_id)
+        SELECT $1, source, external_id
+        FROM jsonb_each_text($2) AS ids(source, external_id)`
+
+	_, err = db.ExecContext(ctx, query, movie.ID, movie.ExternalIDs)
+
+	return externalIDInsertError(err)
+}
+
+// insertExternalIDBatch links newly inserted movies to their external ids with
+// a single statement.
+func insertExternalIDBatch(ctx context.Context, db queryer, movies []*Movie) error {
+	var movieIDs []int64
+	var sources, externalIDs []string
+
+	for _, movie := range movies {
+		for source, externalID := range movie.ExternalIDs {
+			movieIDs = append(movieIDs, movie.ID)
+			sources = append(sources, source)
+			externalIDs = append(externalIDs, externalID)
+		}
+	}
+
+	if len(movieIDs) == 0 {
+		return nil
+	}
+
+	query := `
+        INSERT INTO movie_external_ids (movie_id, source, external_id)
+        SELECT * FROM unnest($1::bigint[], $2::text[], $3::text[])`
+
+	_, err := db.ExecContext(ctx, query, pq.Array(movieIDs), pq.Array(sources), pq.Array(externalIDs))
+
+	return externalIDInsertError(err)
+}
+
+// externalIDInsertError turns the error of inserting an external id that's
+// already linked to a movie into ErrDuplicateExternalID.
+func externalIDInsertError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case err.Error() == `pq: duplicate key value violates unique constraint "movie_external_ids_source_external_id_key"`:
+		return ErrDuplicateExternalID
+	default:
+		return err
+	}
+}
+
+// GetByExternalID returns the movie linked to the given id in an upstream
+// catalog.
+func (model *MovieModel) GetByExternalID(source, externalID string) (*Movie, error) {
+	query := `
+        SELECT movie_id
+        FROM movie_external_ids
+        WHERE source = $1 AND external_id = $2`
+
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	var id int64
+
+	err := model.db.QueryRowContext(cntx, query, source, externalID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return getMovie(cntx, model.db, id)
+}
+
+// GetLinkedExternalIDs returns which of the given external ids are already
+// linked to a movie, trashed ones included, keyed by source and then by id.
+func (model *MovieModel) GetLinkedExternalIDs(ids []ExternalIDs) (map[string]map[string]bool, error) {
+	sources := []string{}
+	externalIDs := []string{}
+
+	for _, movieIDs := range ids {
+		for source, externalID := range movieIDs {
+			sources = append(sources, source)
+			externalIDs = append(externalIDs, externalID)
+		}
+	}
+
+	linked := make(map[string]map[string]bool)
+
+	if len(sources) == 0 {
+		return linked, nil
+	}
+
+	query := `
+        SELECT source, external_id
+        FROM movie_external_ids
+        WHERE (source, external_id) IN (SELECT * FROM unnest($1::text[], $2::text[]))`
+
+	cntx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+	defer cancel()
+
+	rows, err := model.db.QueryContext(cntx, query, pq.Array(sources), pq.Array(externalIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source, externalID string
+
+		err = rows.Scan(&source, &externalID)
+		if err != nil {
+			return nil, err
+		}
+
+		if linked[source] == nil {
+			linked[source] = make(map[string]bool)
+		}
+
+		linked[source][externalID] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return linked, nil
+}
+
+// MovieDuplicate is an existing movie that looks like the same film as a movie
+// about to be created, and the reason why.
+type MovieDuplicate struct {
+	ID     int64  `json:"id"`
+	Title  string `json:"title"`
+	Year   int32  `json:"year"`
+	Reason string `json:"reason"`
+}
+
+// FindDuplicates returns the movies that share an external id, or the title and
+// year, with movie. Matches on an external id are listed first.
+func (model *MovieModel) FindDuplicates(movie *Movie) ([]*MovieDuplicate, error) {
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	return findDuplicateMovies(cntx, model.db, movie)
+}
+
+func findDuplicateMovies(ctx context.Context, db queryer, movie *Movie) ([]*MovieDuplicate, error) {
+	sources := make([]string, 0, len(movie.ExternalIDs))
+	externalIDs := make([]string, 0, len(movie.ExternalIDs))
+
+	for source, externalID := range movie.ExternalIDs {
+		sources = append(sources, source)
+		externalIDs = append(externalIDs, externalID)
+	}
+
+	query := `
+        SELECT id, title, year,
+               CASE WHEN EXISTS (
+                   SELECT 1 FROM movie_external_ids
+                   WHERE movie_id = movies.id AND (source, external_id) IN (SELECT * FROM unnest($3::text[], $4::text[]))
+               ) THEN 'external_id' ELSE 'title_year' END AS reason
+        FROM movies
+        WHERE deleted_at IS NULL AND id <> $5 AND (
+            (lower(title) = lower($1) AND year = $2)
+            OR id IN (
+                SELECT movie_id FROM movie_external_ids
+                WHERE (source, external_id) IN (SELECT * FROM unnest($3::text[], $4::text[]))
+            )
+        )
+        ORDER BY reason, id
+        LIMIT 10`
+
+	args := []any{movie.Title, movie.Year, pq.Array(sources), pq.Array(externalIDs), movie.ID}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	duplicates := []*MovieDuplicate{}
+
+	for rows.Next() {
+		var duplicate MovieDuplicate
+
+		err = rows.Scan(&duplicate.ID, &duplicate.Title, &duplicate.Year, &duplicate.Reason)
+		if err != nil {
+			return nil, err
+		}
+
+		duplicates = append(duplicates, &duplicate)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return duplicates, nil
+}
+
+func validateExternalIDs(v *validator.Validator, ids ExternalIDs) {
+	for source, externalID := range ids {
+		format, ok := externalIDFormats[source]
+		if !ok {
+			v.AddError("external_ids."+source, "is not a supported catalog")
+			continue
+		}
+
+		v.Check(validator.Matches(externalID, format), "external_ids."+source, "must be a valid "+source+" id")
+	}
+}
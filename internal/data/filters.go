@@ -2,6 +2,7 @@ package data
 
 import (
 	"math"
+	"slices"
 	"strings"
 
 	"greenlight.nesty.net/internal/validator"
@@ -12,50 +13,213 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+	// Keyset switches the listing from page numbers to opaque cursors. An
+	// empty Cursor starts from the beginning of the listing.
+	Keyset bool
+	Cursor string
+	// SkipTotal avoids counting every matching row, which is costly for large
+	// result sets. Metadata then reports has_more instead of the last page.
+	SkipTotal bool
+
+	cursor *cursor
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	HasMore      *bool  `json:"has_more,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func ValidateFilters(v *validator.Validator, input *Filters) {
-	v.Check(input.Page > 0, "page", "must be greater than zero")
-	v.Check(input.Page <= 10_000_000, "page", "must be maximum of 10 milion")
+	if input.Keyset {
+		if input.Cursor != "" {
+			c, err := decodeCursor(input.Cursor)
+			switch {
+			case err != nil:
+				v.AddError("cursor", "must be a valid cursor")
+			case c.Sort != input.Sort:
+				v.AddError("cursor", "does not match the sort order")
+			default:
+				input.cursor = c
+			}
+		}
+	} else {
+		v.Check(input.Page > 0, "page", "must be greater than zero")
+		v.Check(input.Page <= 10_000_000, "page", "must be maximum of 10 milion")
+	}
 
 	v.Check(input.PageSize > 0, "page_size", "must be greater thn zero")
-	v.Check(input.PageSize >= 100, "page_size", "must be maximum of 100")
+	v.Check(input.PageSize <= 100, "page_size", "must be maximum of 100")
+
+	seen := make(map[string]bool)
+
+	for _, value := range strings.Split(input.Sort, ",") {
+		column := strings.TrimPrefix(value, "-")
+
+		v.Check(validator.In(value, input.SortSafelist...), "sort", "invalid sort value")
+		v.Check(!seen[column], "sort", "must not sort by the same column more than once")
+
+		seen[column] = true
+	}
+
+	if input.cursor != nil && len(input.cursor.Values) != len(seen) {
+		v.AddError("cursor", "must be a valid cursor")
+	}
+}
 
-	v.Check(validator.In(input.Sort, input.SortSafelist...), "sort", "invalid sort value")
+// sortField is a single entry of a comma-separated sort list.
+type sortField struct {
+	key       string
+	column    string
+	direction string
 }
 
-func (filter *Filters) sortColumn() string {
-	for _, safeValue := range filter.SortSafelist {
-		if safeValue == filter.Sort {
-			return strings.TrimPrefix(filter.Sort, "-")
+// sortFields splits the sort list into its entries. Sort values are used as
+// column names unless columns maps them to a different column or expression. It panics on any
+// value outside the safelist, which ValidateFilters would have rejected.
+func (filter *Filters) sortFields(columns map[string]string) []sortField {
+	values := strings.Split(filter.Sort, ",")
+	fields := make([]sortField, 0, len(values))
+
+	for _, value := range values {
+		if !validator.In(value, filter.SortSafelist...) {
+			panic("unsafe sort parameter: " + value)
+		}
+
+		field := sortField{key: strings.TrimPrefix(value, "-"), direction: "ASC"}
+		field.column = field.key
+
+		if strings.HasPrefix(value, "-") {
+			field.direction = "DESC"
+		}
+
+		if column, ok := columns[field.key]; ok {
+			field.column = column
 		}
+
+		fields = append(fields, field)
 	}
-	panic("unsafe sort parameter: " + filter.Sort)
+
+	return fields
 }
 
-func (filter *Filters) sortDirection() string {
-	if strings.HasPrefix(filter.Sort, "-") {
+// orderBy returns the ORDER BY expression for the sort list, with the
+// tiebreaker column last. A backward cursor reads the listing in reverse.
+func (filter *Filters) orderBy(columns map[string]string) string {
+	backward := filter.cursor != nil && filter.cursor.Backward
+
+	var terms []string
+
+	for _, field := range filter.sortFields(columns) {
+		direction := field.direction
+		if backward {
+			direction = reverseDirection(direction)
+		}
+
+		terms = append(terms, field.column+" "+direction)
+	}
+
+	idDirection := "ASC"
+	if backward {
+		idDirection = reverseDirection(idDirection)
+	}
+
+	return strings.Join(append(terms, tiebreaker(columns)+" "+idDirection), ", ")
+}
+
+// tiebreaker returns the unique column listings fall back on to order rows
+// with equal sort values: id, unless columns maps id to another column.
+func tiebreaker(columns map[string]string) string {
+	if column, ok := columns["id"]; ok {
+		return column
+	}
+	return "id"
+}
+
+func reverseDirection(direction string) string {
+	if direction == "ASC" {
 		return "DESC"
 	}
 	return "ASC"
 }
 
 func (filter *Filters) offset() int {
-	return (filter.PageSize - 1) * filter.Page
+	if filter.Keyset {
+		return 0
+	}
+	return (filter.Page - 1) * filter.PageSize
 }
 
+// limit returns the number of rows to fetch. Keyset listings and listings
+// without a total read one extra row to find out whether another page follows.
 func (filter *Filters) limit() int {
+	if filter.Keyset || filter.SkipTotal {
+		return filter.PageSize + 1
+	}
 	return filter.PageSize
 }
 
+// paginateKeyset trims the extra row read by a keyset listing, restores the
+// listing order for backward cursors and builds the cursors pointing at either
+// end of the page. key returns the values of the sort columns and id of a row.
+func paginateKeyset[T any](filter *Filters, rows []T, key func(T) ([]string, int64)) ([]T, Metadata) {
+	backward := filter.cursor != nil && filter.cursor.Backward
+
+	more := len(rows) > filter.PageSize
+	if more {
+		rows = rows[:filter.PageSize]
+	}
+
+	if backward {
+		slices.Reverse(rows)
+	}
+
+	metadata := Metadata{PageSize: filter.PageSize}
+
+	if len(rows) == 0 {
+		return rows, metadata
+	}
+
+	if backward || more {
+		values, id := key(rows[len(rows)-1])
+		metadata.NextCursor = encodeCursor(cursor{Sort: filter.Sort, Values: values, ID: id})
+	}
+
+	if (backward && more) || (!backward && filter.cursor != nil) {
+		values, id := key(rows[0])
+		metadata.PrevCursor = encodeCursor(cursor{Sort: filter.Sort, Values: values, ID: id, Backward: true})
+	}
+
+	return rows, metadata
+}
+
+// countsTotal reports whether the listing query should count every matching
+// row alongside the page.
+func (filter *Filters) countsTotal() bool {
+	return !filter.Keyset && !filter.SkipTotal
+}
+
+// paginateWithoutTotal trims the extra row read by a listing that skipped the
+// total count and reports whether another page follows.
+func paginateWithoutTotal[T any](filter *Filters, rows []T) ([]T, Metadata) {
+	more := len(rows) > filter.PageSize
+	if more {
+		rows = rows[:filter.PageSize]
+	}
+
+	return rows, Metadata{
+		CurrentPage: filter.Page,
+		PageSize:    filter.PageSize,
+		FirstPage:   1,
+		HasMore:     &more,
+	}
+}
+
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
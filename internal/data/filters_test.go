@@ -0,0 +1,177 @@
+package data
+
+import (
+	"testing"
+
+	"greenlight.nesty.net/internal/validator"
+)
+
+func TestValidateFilters(t *testing.T) {
+	safelist := []string{"id", "title", "year", "-id", "-title", "-year"}
+
+	tests := []struct {
+		name      string
+		filters   Filters
+		wantError string
+	}{
+		{"valid page", Filters{Page: 1, PageSize: 20, Sort: "id"}, ""},
+		{"valid sort list", Filters{Page: 2, PageSize: 100, Sort: "-year,title"}, ""},
+		{"zero page", Filters{Page: 0, PageSize: 20, Sort: "id"}, "page"},
+		{"page too large", Filters{Page: 10_000_001, PageSize: 20, Sort: "id"}, "page"},
+		{"zero page size", Filters{Page: 1, PageSize: 0, Sort: "id"}, "page_size"},
+		{"page size too large", Filters{Page: 1, PageSize: 101, Sort: "id"}, "page_size"},
+		{"unknown sort", Filters{Page: 1, PageSize: 20, Sort: "runtime"}, "sort"},
+		{"empty sort entry", Filters{Page: 1, PageSize: 20, Sort: "title,"}, "sort"},
+		{"repeated sort column", Filters{Page: 1, PageSize: 20, Sort: "title,-title"}, "sort"},
+		{"keyset ignores the page", Filters{Page: 0, PageSize: 20, Sort: "id", Keyset: true}, ""},
+		{"matching cursor", Filters{PageSize: 20, Sort: "-year,title", Keyset: true, Cursor: encodeCursor(cursor{Sort: "-year,title", Values: []string{"1999", "Heat"}, ID: 7})}, ""},
+		{"malformed cursor", Filters{PageSize: 20, Sort: "id", Keyset: true, Cursor: "not a cursor"}, "cursor"},
+		{"cursor for another sort", Filters{PageSize: 20, Sort: "title", Keyset: true, Cursor: encodeCursor(cursor{Sort: "year", Values: []string{"1999"}, ID: 7})}, "cursor"},
+		{"cursor with missing values", Filters{PageSize: 20, Sort: "-year,title", Keyset: true, Cursor: encodeCursor(cursor{Sort: "-year,title", Values: []string{"1999"}, ID: 7})}, "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := tt.filters
+			filters.SortSafelist = safelist
+
+			v := validator.New()
+			ValidateFilters(v, &filters)
+
+			switch {
+			case tt.wantError == "" && !v.Valid():
+				t.Errorf("unexpected errors: %v", v.Errors)
+			case tt.wantError != "" && v.Errors[tt.wantError] == "":
+				t.Errorf("got errors %v; want one for %q", v.Errors, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestFiltersOrderBy(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		columns  map[string]string
+		backward bool
+		want     string
+	}{
+		{"ascending", "title", nil, false, "title ASC, id ASC"},
+		{"descending", "-year", nil, false, "year DESC, id ASC"},
+		{"sort list", "-year,title", nil, false, "year DESC, title ASC, id ASC"},
+		{"mapped column", "-rating", map[string]string{"rating": "average_rating"}, false, "average_rating DESC, id ASC"},
+		{"mapped tiebreaker", "title", map[string]string{"id": "movies.id"}, false, "title ASC, movies.id ASC"},
+		{"backward", "-year,title", nil, true, "year ASC, title DESC, id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{
+				Sort:         tt.sort,
+				SortSafelist: []string{"title", "-year", "-rating"},
+			}
+
+			if tt.backward {
+				filters.cursor = &cursor{Sort: tt.sort, Backward: true}
+			}
+
+			if got := filters.orderBy(tt.columns); got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFiltersOrderByUnsafeSort(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	filters := Filters{Sort: "title; DROP TABLE movies", SortSafelist: []string{"title"}}
+	filters.orderBy(nil)
+}
+
+func TestFiltersLimitAndOffset(t *testing.T) {
+	tests := []struct {
+		name       string
+		filters    Filters
+		wantLimit  int
+		wantOffset int
+	}{
+		{"first page", Filters{Page: 1, PageSize: 20}, 20, 0},
+		{"later page", Filters{Page: 3, PageSize: 20}, 20, 40},
+		{"without total", Filters{Page: 3, PageSize: 20, SkipTotal: true}, 21, 40},
+		{"keyset", Filters{Page: 3, PageSize: 20, Keyset: true}, 21, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filters.limit(); got != tt.wantLimit {
+				t.Errorf("got limit %d; want %d", got, tt.wantLimit)
+			}
+
+			if got := tt.filters.offset(); got != tt.wantOffset {
+				t.Errorf("got offset %d; want %d", got, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestCalculateMetadata(t *testing.T) {
+	tests := []struct {
+		name         string
+		totalRecords int
+		page         int
+		pageSize     int
+		want         Metadata
+	}{
+		{"no records", 0, 1, 20, Metadata{}},
+		{"partial last page", 41, 2, 20, Metadata{CurrentPage: 2, PageSize: 20, FirstPage: 1, LastPage: 3, TotalRecords: 41}},
+		{"full last page", 40, 1, 20, Metadata{CurrentPage: 1, PageSize: 20, FirstPage: 1, LastPage: 2, TotalRecords: 40}},
+		{"single record", 1, 1, 100, Metadata{CurrentPage: 1, PageSize: 100, FirstPage: 1, LastPage: 1, TotalRecords: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calculateMetadata(tt.totalRecords, tt.page, tt.pageSize); got != tt.want {
+				t.Errorf("got %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateWithoutTotal(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     []int
+		wantRows int
+		wantMore bool
+	}{
+		{"empty", []int{}, 0, false},
+		{"partial page", []int{1, 2}, 2, false},
+		{"full page", []int{1, 2, 3}, 3, false},
+		{"extra row", []int{1, 2, 3, 4}, 3, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters := Filters{Page: 2, PageSize: 3, SkipTotal: true}
+
+			rows, metadata := paginateWithoutTotal(&filters, tt.rows)
+
+			if len(rows) != tt.wantRows {
+				t.Errorf("got %d rows; want %d", len(rows), tt.wantRows)
+			}
+
+			if metadata.HasMore == nil || *metadata.HasMore != tt.wantMore {
+				t.Errorf("got has_more %v; want %t", metadata.HasMore, tt.wantMore)
+			}
+
+			if metadata.CurrentPage != 2 || metadata.PageSize != 3 {
+				t.Errorf("got page %d of size %d; want page 2 of size 3", metadata.CurrentPage, metadata.PageSize)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreInUse     = errors.New("genre in use")
+)
+
+type Genre struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	Version   int64     `json:"version"`
+}
+
+type GenreModel struct {
+	DB *sql.DB
+}
+
+// GenreSlug turns a genre name such as "Sci-Fi" into the slug it's stored
+// under, "sci-fi". It matches the slugs built by the genres migration.
+func GenreSlug(name string) string {
+	var b strings.Builder
+
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+
+	return b.String()
+}
+
+// GenreSlugs returns the slugs of the given genre names, in the same order.
+func GenreSlugs(names []string) []string {
+	if names == nil {
+		return nil
+	}
+
+	slugs := make([]string, len(names))
+	for i, name := range names {
+		slugs[i] = GenreSlug(name)
+	}
+
+	return slugs
+}
+
+func (model *GenreModel) Insert(genre *Genre) error {
+	query := `
+        INSERT INTO genres (slug, name)
+        VALUES ($1, $2)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, genre.Slug, genre.Name).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnsureExist adds every slug missing from the catalog, using the slug as its
+// display name until an administrator sets a better one.
+func (model *GenreModel) EnsureExist(slugs []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return ensureGenres(ctx, model.DB, slugs)
+}
+
+func ensureGenres(ctx context.Context, db queryer, slugs []string) error {
+	query := `
+        INSERT INTO genres (slug, name)
+        SELECT slug, slug FROM unnest($1::text[]) AS slug
+        ON CONFLICT (slug) DO NOTHING`
+
+	_, err := db.ExecContext(ctx, query, pq.Array(slugs))
+
+	return err
+}
+
+func (model *GenreModel) Get(id int64) (*Genre, error) {
+	query := `
+        SELECT id, created_at, slug, name, version
+        FROM genres
+        WHERE id = $1`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, id).Scan(
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+func (model *GenreModel) GetAll() ([]*Genre, error) {
+	query := `
+        SELECT id, created_at, slug, name, version
+        FROM genres
+        ORDER BY name ASC, id ASC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			&genre.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// GetSlugs returns the slug of every genre in the catalog.
+func (model *GenreModel) GetSlugs() ([]string, error) {
+	query := `SELECT array_agg(slug) FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	slugs := []string{}
+
+	err := model.DB.QueryRowContext(ctx, query).Scan(pq.Array(&slugs))
+	if err != nil {
+		return nil, err
+	}
+
+	if slugs == nil {
+		return []string{}, nil
+	}
+
+	return slugs, nil
+}
+
+// Update saves the genre. Renaming its slug rewrites the genres of every movie
+// filed under the old slug, bumping their versions and recording the new ones
+// as revisions made by userID.
+func (model *GenreModel) Update(genre *Genre, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldSlug string
+
+	err = tx.QueryRowContext(ctx, `SELECT slug FROM genres WHERE id = $1 FOR UPDATE`, genre.ID).Scan(&oldSlug)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query := `
+        UPDATE genres
+        SET slug = $1, name = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`
+
+	args := []any{genre.Slug, genre.Name, genre.ID, genre.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if oldSlug != genre.Slug {
+		query := `
+            UPDATE movies
+            SET genres = array_replace(genres, $1, $2), version = version + 1
+            WHERE genres @> ARRAY[$1]
+            RETURNING id`
+
+		rows, err := tx.QueryContext(ctx, query, oldSlug, genre.Slug)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+
+		for rows.Next() {
+			var id int64
+
+			err = rows.Scan(&id)
+			if err != nil {
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		// Movies in the trash are renamed too, so that restoring them doesn't
+		// bring back a slug that's gone from the catalog.
+		for _, id := range ids {
+			movie, err := queryMovie(ctx, tx, "id = $1", id)
+			if err != nil {
+				return err
+			}
+
+			err = recordMovieRevision(ctx, tx, movie, userID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes a genre from the catalog, as long as no movie is filed under
+// it any more.
+func (model *GenreModel) Delete(id int64) error {
+	query := `
+        DELETE FROM genres AS g
+        WHERE g.id = $1
+        RETURNING EXISTS (SELECT 1 FROM movies WHERE movies.genres @> ARRAY[g.slug])`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := model.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&inUse)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if inUse {
+		return ErrGenreInUse
+	}
+
+	return tx.Commit()
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(genre.Slug == GenreSlug(genre.Slug), "slug", "must only contain lowercase letters, digits and dashes")
+	v.Check(len(genre.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+}
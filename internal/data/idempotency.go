@@ -0,0 +1,171 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyInUse    = errors.New("idempotency key in use")
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with a different request")
+)
+
+// IdempotencyRecord is a request made with an Idempotency-Key header, together
+// with the response it was answered with. Status is zero while the request is
+// still being handled.
+//
+// Keys are scoped to UserID, which is zero for anonymous requests. Those are
+// scoped by their fingerprint as well, so that a response is only replayed to
+// a request with the same body, and reusing a key for a different request
+// claims it anew rather than being rejected.
+type IdempotencyRecord struct {
+	Key         string
+	UserID      int64
+	RequestPath string
+	Fingerprint []byte
+	Status      int
+	Headers     map[string][]string
+	Body        []byte
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// idempotencyScope matches the row of a record, given the key, user id, request
+// path and fingerprint as $1 to $4.
+const idempotencyScope = `key = $1 AND user_id = $2 AND request_path = $3 AND (user_id <> 0 OR fingerprint = $4)`
+
+// Begin claims the idempotency key of record for ttl and reports whether it did.
+// When the key is already taken by an earlier request, the stored response is
+// loaded into record instead, unless that request had a different fingerprint
+// or is still being handled.
+func (model *IdempotencyModel) Begin(record *IdempotencyRecord, ttl time.Duration) (bool, error) {
+	conflict := "(key, user_id, request_path) WHERE user_id <> 0"
+	if record.UserID == 0 {
+		conflict = "(key, request_path, fingerprint) WHERE user_id = 0"
+	}
+
+	query := `
+        INSERT INTO idempotency_keys (key, user_id, request_path, fingerprint, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT ` + conflict + ` DO UPDATE
+        SET fingerprint = EXCLUDED.fingerprint, status = NULL, headers = NULL, body = NULL,
+            created_at = NOW(), expires_at = EXCLUDED.expires_at
+        WHERE idempotency_keys.expires_at <= NOW()
+        RETURNING true`
+
+	args := []any{record.Key, record.UserID, record.RequestPath, record.Fingerprint, time.Now().Add(ttl)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var claimed bool
+
+	err := model.DB.QueryRowContext(ctx, query, args...).Scan(&claimed)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	query = `
+        SELECT fingerprint, status, headers, body
+        FROM idempotency_keys
+        WHERE ` + idempotencyScope
+
+	var (
+		fingerprint []byte
+		status      sql.NullInt32
+		headers     []byte
+	)
+
+	err = model.DB.QueryRowContext(ctx, query, record.Key, record.UserID, record.RequestPath, record.Fingerprint).Scan(&fingerprint, &status, &headers, &record.Body)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// The key was released between the two queries.
+			return false, ErrIdempotencyKeyInUse
+		default:
+			return false, err
+		}
+	}
+
+	if string(fingerprint) != string(record.Fingerprint) {
+		return false, ErrIdempotencyKeyMismatch
+	}
+
+	if !status.Valid {
+		return false, ErrIdempotencyKeyInUse
+	}
+
+	record.Status = int(status.Int32)
+
+	if headers != nil {
+		err = json.Unmarshal(headers, &record.Headers)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// Complete stores the response to a request whose key was claimed by Begin.
+func (model *IdempotencyModel) Complete(record *IdempotencyRecord) error {
+	query := `
+        UPDATE idempotency_keys
+        SET status = $5, headers = $6, body = $7
+        WHERE ` + idempotencyScope
+
+	headers, err := json.Marshal(record.Headers)
+	if err != nil {
+		return err
+	}
+
+	args := []any{record.Key, record.UserID, record.RequestPath, record.Fingerprint, record.Status, string(headers), record.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = model.DB.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// Release frees a key claimed by Begin without storing a response, so that the
+// request can be retried.
+func (model *IdempotencyModel) Release(record *IdempotencyRecord) error {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE ` + idempotencyScope
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := model.DB.ExecContext(ctx, query, record.Key, record.UserID, record.RequestPath, record.Fingerprint)
+
+	return err
+}
+
+// DeleteExpired deletes the keys whose ttl has passed, and returns how many were
+// deleted.
+func (model *IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+        DELETE FROM idempotency_keys
+        WHERE expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+)
+
+// ImageKinds are the kinds of image that can be uploaded for a movie.
+var ImageKinds = []string{ImagePoster, ImageBackdrop}
+
+// ImageURLs maps thumbnail sizes, such as "w185", to their URLs. It's stored as
+// a jsonb column.
+type ImageURLs map[string]string
+
+func (urls *ImageURLs) Scan(value any) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into ImageURLs", value)
+	}
+
+	return json.Unmarshal(b, urls)
+}
+
+// Value encodes the URLs as a string, since lib/pq sends []byte parameters as
+// bytea, which doesn't convert to jsonb.
+func (urls ImageURLs) Value() (driver.Value, error) {
+	if urls == nil {
+		return "{}", nil
+	}
+
+	js, err := json.Marshal(urls)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(js), nil
+}
+
+// ImageURLs returns the URLs of the original and thumbnails of the poster or
+// backdrop of a movie, or none when it has no such image.
+func (movie *Movie) ImageURLs(kind string) []string {
+	url, thumbnails := movie.PosterURL, movie.PosterThumbnails
+	if kind == ImageBackdrop {
+		url, thumbnails = movie.BackdropURL, movie.BackdropThumbnails
+	}
+
+	if url == "" {
+		return nil
+	}
+
+	urls := []string{url}
+
+	for _, thumbnail := range thumbnails {
+		urls = append(urls, thumbnail)
+	}
+
+	return urls
+}
+
+// SetImage replaces the poster or backdrop of a movie, bumping its version and
+// recording the new one as a revision made by userID. The movie's credits must
+// be loaded, and ErrEditConflict is returned when it has changed since.
+func (model *MovieModel) SetImage(movie *Movie, kind string, url string, thumbnails ImageURLs, userID int64) error {
+	var query string
+
+	switch kind {
+	case ImagePoster:
+		query = `
+        UPDATE movies
+        SET poster_url = $1, poster_thumbnails = $2, version = version + 1
+        WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+        RETURNING version`
+	case ImageBackdrop:
+		query = `
+        UPDATE movies
+        SET backdrop_url = $1, backdrop_thumbnails = $2, version = version + 1
+        WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+        RETURNING version`
+	default:
+		return fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	return withTx(cntx, model.db, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(cntx, query, url, thumbnails, movie.ID, movie.Version).Scan(&movie.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+
+		if kind == ImagePoster {
+			movie.PosterURL, movie.PosterThumbnails = url, thumbnails
+		} else {
+			movie.BackdropURL, movie.BackdropThumbnails = url, thumbnails
+		}
+
+		return recordMovieRevision(cntx, tx, movie, userID)
+	})
+}
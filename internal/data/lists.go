@@ -0,0 +1,545 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// WatchlistName is the name of the default list every user has.
+const WatchlistName = "watchlist"
+
+var (
+	ErrDuplicateListName = errors.New("duplicate list name")
+	ErrDuplicateListItem = errors.New("duplicate list item")
+)
+
+// listItemSortColumns maps sort values accepted by list item listings to the
+// columns they order by.
+var listItemSortColumns = map[string]string{
+	"id":       "movies.id",
+	"position": "list_items.position",
+	"added_at": "list_items.added_at",
+	"title":    "movies.title",
+	"year":     "movies.year",
+}
+
+type List struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      int64     `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Public      bool      `json:"public"`
+	Default     bool      `json:"default"`
+	ItemCount   int       `json:"item_count"`
+	Version     int64     `json:"version"`
+}
+
+// ListItem is a movie on a list, together with its place on it. Positions start
+// at 1.
+type ListItem struct {
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie"`
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+// listItemCountColumn counts the movies on a list, leaving out the ones in the
+// trash.
+const listItemCountColumn = `(
+            SELECT count(*) FROM list_items
+            INNER JOIN movies ON movies.id = list_items.movie_id
+            WHERE list_items.list_id = lists.id AND movies.deleted_at IS NULL
+        )`
+
+func (model *ListModel) Insert(list *List) error {
+	query := `
+        INSERT INTO lists (user_id, name, description, is_public)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, created_at, version`
+
+	args := []any{list.UserID, list.Name, list.Description, list.Public}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`:
+			return ErrDuplicateListName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnsureWatchlist creates the default list of a user, unless they already have
+// one.
+func (model *ListModel) EnsureWatchlist(userID int64) error {
+	query := `
+        INSERT INTO lists (user_id, name, is_default)
+        VALUES ($1, $2, true)
+        ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := model.DB.ExecContext(ctx, query, userID, WatchlistName)
+
+	return err
+}
+
+func (model *ListModel) Get(id int64) (*List, error) {
+	query := fmt.Sprintf(`
+        SELECT id, created_at, user_id, name, description, is_public, is_default, %s, version
+        FROM lists
+        WHERE id = $1`, listItemCountColumn)
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, id).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UserID,
+		&list.Name,
+		&list.Description,
+		&list.Public,
+		&list.Default,
+		&list.ItemCount,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAllForUser returns every list of a user, their watchlist first and the
+// rest in the order they were created.
+func (model *ListModel) GetAllForUser(userID int64) ([]*List, error) {
+	query := fmt.Sprintf(`
+        SELECT id, created_at, user_id, name, description, is_public, is_default, %s, version
+        FROM lists
+        WHERE user_id = $1
+        ORDER BY is_default DESC, created_at, id`, listItemCountColumn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&list.ID,
+			&list.CreatedAt,
+			&list.UserID,
+			&list.Name,
+			&list.Description,
+			&list.Public,
+			&list.Default,
+			&list.ItemCount,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (model *ListModel) Update(list *List) error {
+	query := `
+        UPDATE lists
+        SET name = $1, description = $2, is_public = $3, version = version + 1
+        WHERE id = $4 AND version = $5
+        RETURNING version`
+
+	args := []any{list.Name, list.Description, list.Public, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, args...).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "lists_user_id_name_key"`:
+			return ErrDuplicateListName
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (model *ListModel) Delete(id int64) error {
+	query := `
+        DELETE FROM lists
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (model *ListModel) GetItems(listID int64, filters Filters) ([]*ListItem, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), list_items.position, list_items.added_at,
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        FROM list_items
+        INNER JOIN movies ON movies.id = list_items.movie_id
+        WHERE list_items.list_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy(listItemSortColumns))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, listID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*ListItem{}
+
+	for rows.Next() {
+		var item ListItem
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.Position,
+			&item.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		item.Movie = &movie
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+// AddItem adds the movie of item to a list at the position of item, moving the
+// movies from there on down by one. A zero position, or one past the end of the
+// list, appends the movie. The position the movie ended up at is stored in item.
+func (model *ListModel) AddItem(listID int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return withTx(ctx, model.DB, func(tx *sql.Tx) error {
+		count, err := lockListItems(ctx, tx, listID)
+		if err != nil {
+			return err
+		}
+
+		if item.Position < 1 || item.Position > count {
+			item.Position = count + 1
+		}
+
+		query := `
+            UPDATE list_items
+            SET position = position + 1
+            WHERE list_id = $1 AND position >= $2`
+
+		_, err = tx.ExecContext(ctx, query, listID, item.Position)
+		if err != nil {
+			return err
+		}
+
+		query = `
+            INSERT INTO list_items (list_id, movie_id, position)
+            VALUES ($1, $2, $3)
+            RETURNING added_at`
+
+		err = tx.QueryRowContext(ctx, query, listID, item.Movie.ID, item.Position).Scan(&item.AddedAt)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+				return ErrDuplicateListItem
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// MoveItem moves the movie of item to the position of item on a list, shifting
+// the movies in between to close the gap. Positions past the end of the list
+// move the movie to the end, which is then stored in item.
+func (model *ListModel) MoveItem(listID int64, item *ListItem) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return withTx(ctx, model.DB, func(tx *sql.Tx) error {
+		count, err := lockListItems(ctx, tx, listID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+            SELECT position, added_at
+            FROM list_items
+            WHERE list_id = $1 AND movie_id = $2`
+
+		var current int
+
+		err = tx.QueryRowContext(ctx, query, listID, item.Movie.ID).Scan(&current, &item.AddedAt)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		item.Position = min(item.Position, count)
+
+		if item.Position == current {
+			return nil
+		}
+
+		if item.Position < current {
+			query = `
+                UPDATE list_items
+                SET position = position + 1
+                WHERE list_id = $1 AND position >= $2 AND position < $3`
+		} else {
+			query = `
+                UPDATE list_items
+                SET position = position - 1
+                WHERE list_id = $1 AND position <= $2 AND position > $3`
+		}
+
+		_, err = tx.ExecContext(ctx, query, listID, item.Position, current)
+		if err != nil {
+			return err
+		}
+
+		query = `
+            UPDATE list_items
+            SET position = $1
+            WHERE list_id = $2 AND movie_id = $3`
+
+		_, err = tx.ExecContext(ctx, query, item.Position, listID, item.Movie.ID)
+
+		return err
+	})
+}
+
+// RemoveItem takes a movie off a list, moving the movies after it up by one.
+func (model *ListModel) RemoveItem(listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return withTx(ctx, model.DB, func(tx *sql.Tx) error {
+		_, err := lockListItems(ctx, tx, listID)
+		if err != nil {
+			return err
+		}
+
+		query := `
+            DELETE FROM list_items
+            WHERE list_id = $1 AND movie_id = $2
+            RETURNING position`
+
+		var position int
+
+		err = tx.QueryRowContext(ctx, query, listID, movieID).Scan(&position)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+            UPDATE list_items
+            SET position = position - 1
+            WHERE list_id = $1 AND position > $2`
+
+		_, err = tx.ExecContext(ctx, query, listID, position)
+
+		return err
+	})
+}
+
+// lockListItems locks a list for the rest of tx, so that concurrent changes to
+// its items can't interleave their position updates, and returns the number of
+// movies on it, including the ones in the trash.
+func lockListItems(ctx context.Context, tx *sql.Tx, listID int64) (int, error) {
+	query := `
+        SELECT id
+        FROM lists
+        WHERE id = $1
+        FOR UPDATE`
+
+	var id int64
+
+	err := tx.QueryRowContext(ctx, query, listID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	query = `
+        SELECT count(*)
+        FROM list_items
+        WHERE list_id = $1`
+
+	var count int
+
+	err = tx.QueryRowContext(ctx, query, listID).Scan(&count)
+
+	return count, err
+}
+
+// lockMovieLists locks the lists that any of movieIDs are on, in id order, as
+// lockListItems does, and returns their ids.
+func lockMovieLists(ctx context.Context, tx *sql.Tx, movieIDs []int64) ([]int64, error) {
+	query := `
+        SELECT id
+        FROM lists
+        WHERE id IN (SELECT list_id FROM list_items WHERE movie_id = ANY($1))
+        ORDER BY id
+        FOR UPDATE`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// renumberListItems closes the gaps left in the positions of lists by movies
+// taken off them other than through RemoveItem, such as purged ones.
+func renumberListItems(ctx context.Context, tx *sql.Tx, listIDs []int64) error {
+	if len(listIDs) == 0 {
+		return nil
+	}
+
+	query := `
+        UPDATE list_items
+        SET position = numbered.position
+        FROM (
+            SELECT list_id, movie_id, row_number() OVER (PARTITION BY list_id ORDER BY position, added_at) AS position
+            FROM list_items
+            WHERE list_id = ANY($1)
+        ) AS numbered
+        WHERE list_items.list_id = numbered.list_id AND list_items.movie_id = numbered.movie_id
+            AND list_items.position <> numbered.position`
+
+	_, err := tx.ExecContext(ctx, query, pq.Array(listIDs))
+
+	return err
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(strings.TrimSpace(list.Name) != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(list.Default || !strings.EqualFold(strings.TrimSpace(list.Name), WatchlistName), "name", "is reserved for the default list")
+
+	v.Check(len(list.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -10,18 +11,59 @@ var (
 	ErrRecordNotFound = errors.New("record not found")
 )
 
+// queryer is implemented by both *sql.DB and *sql.Tx, so queries can run
+// either on their own or as part of a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// withTx runs fn within a transaction on db, committing it when fn returns nil
+// and rolling it back otherwise.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 type Models struct {
-	Movie       MovieModel
-	User        UserModel
-	Token       TokenModel
-	Permissions PermissionModel
+	Movie          MovieModel
+	User           UserModel
+	Token          TokenModel
+	Permissions    PermissionModel
+	Review         ReviewModel
+	Person         PersonModel
+	Genre          GenreModel
+	Revision       MovieRevisionModel
+	Idempotency    IdempotencyModel
+	List           ListModel
+	WatchHistory   WatchHistoryModel
+	Recommendation RecommendationModel
 }
 
 func NewModel(db *sql.DB) Models {
 	return Models{
-		Movie:       MovieModel{db: db},
-		User:        UserModel{DB: db},
-		Token:       TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movie:          MovieModel{db: db},
+		User:           UserModel{DB: db},
+		Token:          TokenModel{DB: db},
+		Permissions:    PermissionModel{DB: db},
+		Review:         ReviewModel{DB: db},
+		Person:         PersonModel{DB: db},
+		Genre:          GenreModel{DB: db},
+		Revision:       MovieRevisionModel{DB: db},
+		Idempotency:    IdempotencyModel{DB: db},
+		List:           ListModel{DB: db},
+		WatchHistory:   WatchHistoryModel{DB: db},
+		Recommendation: RecommendationModel{DB: db},
 	}
 }
@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"maps"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -12,20 +15,209 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year"`
-	Runtime   Runtime   `json:"runtime"`
-	Genres    []string  `json:"genres"`
-	Version   int64     `json:"version"`
+	ID                 int64       `json:"id"`
+	CreatedAt          time.Time   `json:"created_at"`
+	Title              string      `json:"title"`
+	Year               int32       `json:"year"`
+	Runtime            Runtime     `json:"runtime"`
+	Genres             []string    `json:"genres"`
+	AverageRating      float64     `json:"average_rating"`
+	RatingCount        int32       `json:"rating_count"`
+	Relevance          float32     `json:"relevance,omitempty"`
+	Highlight          string      `json:"highlight,omitempty"`
+	Directors          []Credit    `json:"directors,omitempty"`
+	Cast               []Credit    `json:"cast,omitempty"`
+	ExternalIDs        ExternalIDs `json:"external_ids,omitempty"`
+	PosterURL          string      `json:"poster_url,omitempty"`
+	PosterThumbnails   ImageURLs   `json:"poster_thumbnails,omitempty"`
+	BackdropURL        string      `json:"backdrop_url,omitempty"`
+	BackdropThumbnails ImageURLs   `json:"backdrop_thumbnails,omitempty"`
+	DeletedAt          *time.Time  `json:"deleted_at,omitempty"`
+	Version            int64       `json:"version"`
+}
+
+// movieSortColumns maps sort values accepted by the movies listing to the
+// column they order by, where the two differ.
+var movieSortColumns = map[string]string{
+	"rating": "average_rating",
+}
+
+// SearchLanguages lists the text search configurations movie titles can be
+// searched with. Each of them has a matching GIN index on movies.title.
+var SearchLanguages = []string{"simple", "english", "german", "french", "spanish"}
+
+// movieSortValue returns the value a movie has for the given sort key, in a
+// form Postgres can compare against the column the key sorts by.
+func movieSortValue(movie *Movie, key string) string {
+	switch key {
+	case "title":
+		return movie.Title
+	case "year":
+		return strconv.FormatInt(int64(movie.Year), 10)
+	case "runtime":
+		return strconv.FormatInt(int64(movie.Runtime), 10)
+	case "rating":
+		return strconv.FormatFloat(movie.AverageRating, 'f', -1, 64)
+	case "relevance":
+		return strconv.FormatFloat(float64(-movie.Relevance), 'f', -1, 32)
+	case "deleted_at":
+		if movie.DeletedAt != nil {
+			return movie.DeletedAt.Format(time.RFC3339Nano)
+		}
+		return ""
+	default:
+		return strconv.FormatInt(movie.ID, 10)
+	}
+}
+
+// MovieQuery holds the criteria a movie listing can be narrowed down by. Zero
+// values leave the matching criterion out. Fuzzy switches the title search from
+// full-text search to trigram similarity, so misspelled titles still match.
+// Trashed lists the movies in the trash instead of the live ones. Watched, when
+// set, keeps only the movies WatchedBy has or hasn't marked as watched.
+type MovieQuery struct {
+	Title         string
+	Language      string
+	Fuzzy         bool
+	Genres        []string
+	GenresAny     []string
+	YearMin       int32
+	YearMax       int32
+	RuntimeMin    Runtime
+	RuntimeMax    Runtime
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Trashed       bool
+	Watched       *bool
+	WatchedBy     int64
+}
+
+// where builds the WHERE clause shared by every query over the movies
+// matching the criteria.
+func (search *MovieQuery) where() *whereClause {
+	where := &whereClause{}
+
+	if search.Trashed {
+		where.add("deleted_at IS NOT NULL")
+	} else {
+		where.add("deleted_at IS NULL")
+	}
+
+	switch {
+	case search.Title != "" && search.Fuzzy:
+		where.add("$%d <%% title", search.Title)
+	case search.Title != "":
+		where.add(fmt.Sprintf("to_tsvector('%[1]s', title) @@ plainto_tsquery('%[1]s', $%%d)", search.language()), search.Title)
+	}
+	if len(search.Genres) > 0 {
+		where.add("genres @> $%d", pq.Array(search.Genres))
+	}
+	if len(search.GenresAny) > 0 {
+		where.add("genres && $%d", pq.Array(search.GenresAny))
+	}
+	if search.YearMin != 0 {
+		where.add("year >= $%d", search.YearMin)
+	}
+	if search.YearMax != 0 {
+		where.add("year <= $%d", search.YearMax)
+	}
+	if search.RuntimeMin != 0 {
+		where.add("runtime >= $%d", search.RuntimeMin)
+	}
+	if search.RuntimeMax != 0 {
+		where.add("runtime <= $%d", search.RuntimeMax)
+	}
+	if !search.CreatedAfter.IsZero() {
+		where.add("created_at > $%d", search.CreatedAfter)
+	}
+	if !search.CreatedBefore.IsZero() {
+		where.add("created_at < $%d", search.CreatedBefore)
+	}
+	if search.Watched != nil {
+		condition := "EXISTS (SELECT 1 FROM watched_movies WHERE watched_movies.movie_id = movies.id AND watched_movies.user_id = $%d)"
+		if !*search.Watched {
+			condition = "NOT " + condition
+		}
+		where.add(condition, search.WatchedBy)
+	}
+
+	return where
+}
+
+// textSearch returns the expressions ranking and highlighting the titles that
+// match the title search, or constants when there's no title search. Fuzzy
+// searches rank by similarity and aren't highlighted.
+func (search *MovieQuery) textSearch(where *whereClause) (rank string, headline string) {
+	if search.Title == "" {
+		return "0", "''"
+	}
+
+	if search.Fuzzy {
+		return fmt.Sprintf("word_similarity(%s, title)", where.arg(search.Title)), "''"
+	}
+
+	tsquery := fmt.Sprintf("plainto_tsquery('%s', %s)", search.language(), where.arg(search.Title))
+
+	rank = fmt.Sprintf("ts_rank(to_tsvector('%s', title), %s)", search.language(), tsquery)
+	headline = fmt.Sprintf("ts_headline('%s', title, %s)", search.language(), tsquery)
+
+	return rank, headline
+}
+
+// language returns the text search configuration, which is interpolated into
+// queries so that they match the per-language title indexes. Anything outside
+// of SearchLanguages falls back to 'simple'.
+func (search *MovieQuery) language() string {
+	if validator.In(search.Language, SearchLanguages...) {
+		return search.Language
+	}
+	return "simple"
+}
+
+// MovieFacets lists the facets the movies matching a MovieQuery can be counted
+// by.
+var MovieFacets = []string{"genres", "year", "decade"}
+
+// movieFacetQueries holds the aggregate query for each facet. Every query
+// yields the facet name, a facet value and the number of movies with it.
+var movieFacetQueries = map[string]string{
+	"genres": `SELECT 'genres', genre, count(*) FROM movies, unnest(genres) AS genre WHERE %s GROUP BY genre`,
+	"year":   `SELECT 'year', year::text, count(*) FROM movies WHERE %s GROUP BY year`,
+	"decade": `SELECT 'decade', (year / 10 * 10)::text || 's', count(*) FROM movies WHERE %s GROUP BY 2`,
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets maps a facet name to the counts of its values, most common first.
+type Facets map[string][]FacetCount
+
+// MovieSuggestion is a title suggested while a user is typing a search.
+type MovieSuggestion struct {
+	ID         int64   `json:"id"`
+	Title      string  `json:"title"`
+	Year       int32   `json:"year"`
+	Similarity float32 `json:"similarity"`
 }
 
 type MovieModel struct {
 	db *sql.DB
 }
 
-func (model *MovieModel) Insert(movie *Movie) error {
+// Insert adds a movie and records its first revision as made by userID.
+func (model *MovieModel) Insert(movie *Movie, userID int64) error {
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	return withTx(cntx, model.db, func(tx *sql.Tx) error {
+		return insertMovie(cntx, tx, movie, userID)
+	})
+}
+
+func insertMovie(ctx context.Context, db queryer, movie *Movie, userID int64) error {
 	query := `
         INSERT INTO movies (title, year, runtime, genres)
         VALUES ($1, $2, $3, $4)
@@ -33,32 +225,187 @@ func (model *MovieModel) Insert(movie *Movie) error {
 
 	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
 
-	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
 
-	defer cancel()
+	err = setMovieCredits(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	err = setMovieExternalIDs(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	err = getMovieCredits(ctx, db, movie)
+	if err != nil {
+		return err
+	}
 
-	return model.db.QueryRowContext(cntx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	return recordMovieRevision(ctx, db, movie, userID)
 }
 
-func (model *MovieModel) Get(id int64) (*Movie, error) {
+// movieInsertBatchSize is the number of movies InsertMany writes with a single
+// INSERT statement.
+const movieInsertBatchSize = 500
+
+// insertMovies inserts new movies along with their credits, external ids and
+// first revision, writing each of them with one multi-row statement per batch
+// of movies.
+func insertMovies(ctx context.Context, db queryer, movies []*Movie, userID int64) error {
+	for start := 0; start < len(movies); start += movieInsertBatchSize {
+		batch := movies[start:min(start+movieInsertBatchSize, len(movies))]
+
+		err := insertMovieBatch(ctx, db, batch)
+		if err != nil {
+			return err
+		}
+
+		err = insertCreditBatch(ctx, db, batch)
+		if err != nil {
+			return err
+		}
+
+		err = insertExternalIDBatch(ctx, db, batch)
+		if err != nil {
+			return err
+		}
+
+		err = recordNewMovieRevisions(ctx, db, batch, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertMovieBatch inserts movies with one multi-row INSERT statement. The ids
+// are drawn from the movies sequence beforehand, so that the inserted rows can
+// be matched back to the movies by id rather than by the order they're
+// returned in.
+func insertMovieBatch(ctx context.Context, db queryer, movies []*Movie) error {
 	query := `
-        SELECT  id, created_at, title, year, runtime, genres, version
-        FROM movies
-        WHERE id = $1`
+        SELECT nextval(pg_get_serial_sequence('movies', 'id'))
+        FROM generate_series(1, $1)`
 
-	var movie Movie
+	rows, err := db.QueryContext(ctx, query, len(movies))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*Movie, len(movies))
 
+	for rows.Next() {
+		if len(byID) == len(movies) {
+			return errors.New("movies sequence returned more ids than requested")
+		}
+
+		movie := movies[len(byID)]
+
+		err = rows.Scan(&movie.ID)
+		if err != nil {
+			return err
+		}
+
+		byID[movie.ID] = movie
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if len(byID) != len(movies) {
+		return fmt.Errorf("movies sequence returned %d ids for %d movies", len(byID), len(movies))
+	}
+
+	values := make([]string, len(movies))
+	args := make([]any, 0, 9*len(movies))
+
+	for i, movie := range movies {
+		placeholders := make([]string, 9)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", 9*i+j+1)
+		}
+
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+		args = append(args, movie.ID, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres),
+			movie.PosterURL, movie.PosterThumbnails, movie.BackdropURL, movie.BackdropThumbnails)
+	}
+
+	query = fmt.Sprintf(`
+        INSERT INTO movies (id, title, year, runtime, genres, poster_url, poster_thumbnails, backdrop_url, backdrop_thumbnails)
+        VALUES %s
+        RETURNING id, created_at, version`, strings.Join(values, ", "))
+
+	rows, err = db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var createdAt time.Time
+		var version int64
+
+		err = rows.Scan(&id, &createdAt, &version)
+		if err != nil {
+			return err
+		}
+
+		movie, ok := byID[id]
+		if !ok {
+			return fmt.Errorf("insert returned unknown movie id %d", id)
+		}
+
+		movie.CreatedAt, movie.Version = createdAt, version
+	}
+
+	return rows.Err()
+}
+
+func (model *MovieModel) Get(id int64) (*Movie, error) {
 	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 
 	defer cancel()
 
-	err := model.db.QueryRowContext(cntx, query, id).Scan(
+	return getMovie(cntx, model.db, id)
+}
+
+func getMovie(ctx context.Context, db queryer, id int64) (*Movie, error) {
+	return queryMovie(ctx, db, "id = $1 AND deleted_at IS NULL", id)
+}
+
+// queryMovie returns the movie matching the where condition, along with its
+// credits.
+func queryMovie(ctx context.Context, db queryer, where string, args ...any) (*Movie, error) {
+	query := `
+        SELECT  id, created_at, title, year, runtime, genres, average_rating, rating_count,
+                poster_url, poster_thumbnails, backdrop_url, backdrop_thumbnails, ` + externalIDsColumn + `, version
+        FROM movies
+        WHERE ` + where
+
+	var movie Movie
+
+	err := db.QueryRowContext(ctx, query, args...).Scan(
 		&movie.ID,
 		&movie.CreatedAt,
 		&movie.Title,
 		&movie.Year,
 		&movie.Runtime,
 		pq.Array(&movie.Genres),
+		&movie.AverageRating,
+		&movie.RatingCount,
+		&movie.PosterURL,
+		&movie.PosterThumbnails,
+		&movie.BackdropURL,
+		&movie.BackdropThumbnails,
+		&movie.ExternalIDs,
 		&movie.Version,
 	)
 	if err != nil {
@@ -69,25 +416,49 @@ func (model *MovieModel) Get(id int64) (*Movie, error) {
 			return nil, err
 		}
 	}
+
+	err = getMovieCredits(ctx, db, &movie)
+	if err != nil {
+		return nil, err
+	}
+
 	return &movie, nil
 }
 
-func (model *MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (model *MovieModel) GetAll(search MovieQuery, filters Filters) ([]*Movie, Metadata, error) {
+	where := search.where()
+
+	rank, headline := search.textSearch(where)
+
+	// Relevance orders by the negated rank, so that sort=relevance lists the
+	// best matches first.
+	columns := maps.Clone(movieSortColumns)
+	columns["relevance"] = "-" + rank
+
+	if filters.cursor != nil {
+		filters.addKeysetCondition(where, columns)
+	}
+
+	total := "0"
+	if filters.countsTotal() {
+		total = "count(*) OVER()"
+	}
+
+	limit, offset := where.arg(filters.limit()), where.arg(filters.offset())
+
 	query := fmt.Sprintf(`
-        SELECT id, created_at, title, year, runtime, genres, version
+        SELECT %s, id, created_at, title, year, runtime, genres, average_rating, rating_count, %s, %s,
+               poster_url, poster_thumbnails, backdrop_url, backdrop_thumbnails, %s, deleted_at, version
         FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-        AND (genres @> $2 OR $2 = '{}')
-        ORDER BY %s %s, id ASC
-        LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+        WHERE %s
+        ORDER BY %s
+        LIMIT %s OFFSET %s`, total, rank, headline, externalIDsColumn, where, filters.orderBy(columns), limit, offset)
 
 	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
-
-	rows, err := model.db.QueryContext(cntx, query, args...)
+	rows, err := model.db.QueryContext(cntx, query, where.args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -95,18 +466,29 @@ func (model *MovieModel) GetAll(title string, genres []string, filters Filters)
 	defer rows.Close()
 
 	movies := []*Movie{}
-	totalRecords := 1
+	totalRecords := 0
 
 	for rows.Next() {
 		var movie Movie
 
 		err := rows.Scan(
+			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
 			&movie.Title,
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Relevance,
+			&movie.Highlight,
+			&movie.PosterURL,
+			&movie.PosterThumbnails,
+			&movie.BackdropURL,
+			&movie.BackdropThumbnails,
+			&movie.ExternalIDs,
+			&movie.DeletedAt,
 			&movie.Version,
 		)
 		if err != nil {
@@ -116,16 +498,207 @@ func (model *MovieModel) GetAll(title string, genres []string, filters Filters)
 		movies = append(movies, &movie)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	if filters.Keyset {
+		fields := filters.sortFields(columns)
+
+		movies, metadata := paginateKeyset(&filters, movies, func(movie *Movie) ([]string, int64) {
+			values := make([]string, len(fields))
+			for i, field := range fields {
+				values[i] = movieSortValue(movie, field.key)
+			}
+			return values, movie.ID
+		})
+		return movies, metadata, nil
+	}
+
+	if filters.SkipTotal {
+		movies, metadata := paginateWithoutTotal(&filters, movies)
+		return movies, metadata, nil
+	}
+
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
 	return movies, metadata, nil
 }
 
-func (model *MovieModel) Update(movie *Movie) error {
+// Export streams every movie matching search to fn in id order, without
+// loading them all into memory. It stops at the first error returned by fn, and
+// when ctx is cancelled.
+func (model *MovieModel) Export(ctx context.Context, search MovieQuery, fn func(*Movie) error) error {
+	where := search.where()
+
+	query := fmt.Sprintf(`
+        SELECT id, created_at, title, year, runtime, genres, average_rating, rating_count,
+            poster_url, poster_thumbnails, backdrop_url, backdrop_thumbnails, %s, version
+        FROM movies
+        WHERE %s
+        ORDER BY id`, externalIDsColumn, where)
+
+	cntx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+
+	defer cancel()
+
+	rows, err := model.db.QueryContext(cntx, query, where.args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.PosterURL,
+			&movie.PosterThumbnails,
+			&movie.BackdropURL,
+			&movie.BackdropThumbnails,
+			&movie.ExternalIDs,
+			&movie.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&movie)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Autocomplete returns up to limit titles resembling the typed prefix, best
+// matches first. Suggestions must arrive while the user is still typing, so the
+// query gets a tight deadline and returns no suggestions if it runs past it.
+func (model *MovieModel) Autocomplete(prefix string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+        SELECT id, title, year, word_similarity($1, title) AS similarity
+        FROM movies
+        WHERE $1 <% title AND deleted_at IS NULL
+        ORDER BY similarity DESC, title ASC
+        LIMIT $2`
+
+	cntx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+
+	defer cancel()
+
+	suggestions := []*MovieSuggestion{}
+
+	rows, err := model.db.QueryContext(cntx, query, prefix, limit)
+	if err != nil {
+		if cntx.Err() != nil {
+			return suggestions, nil
+		}
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year, &suggestion.Similarity)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+
+	if err = rows.Err(); err != nil {
+		if cntx.Err() != nil {
+			return []*MovieSuggestion{}, nil
+		}
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// GetFacets counts the movies matching search by each of the given facets,
+// which must all be listed in MovieFacets.
+func (model *MovieModel) GetFacets(search MovieQuery, facets []string) (Facets, error) {
+	where := search.where()
+
+	var selects []string
+
+	for _, facet := range facets {
+		query, ok := movieFacetQueries[facet]
+		if !ok {
+			panic("unknown facet: " + facet)
+		}
+
+		selects = append(selects, fmt.Sprintf(query, where))
+	}
+
+	query := strings.Join(selects, " UNION ALL ") + " ORDER BY 1, 3 DESC, 2"
+
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	rows, err := model.db.QueryContext(cntx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := Facets{}
+	for _, facet := range facets {
+		result[facet] = []FacetCount{}
+	}
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+
+		err := rows.Scan(&facet, &count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		result[facet] = append(result[facet], count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Update saves a movie and records the new version as a revision made by
+// userID.
+func (model *MovieModel) Update(movie *Movie, userID int64) error {
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	return withTx(cntx, model.db, func(tx *sql.Tx) error {
+		return updateMovie(cntx, tx, movie, userID)
+	})
+}
+
+func updateMovie(ctx context.Context, db queryer, movie *Movie, userID int64) error {
 	query := `
         UPDATE movies
         SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1 
-        WHERE id = $5 AND version = $6
+        WHERE id = $5 AND version = $6 AND deleted_at IS NULL
         RETURNING version
     `
 
@@ -138,11 +711,7 @@ func (model *MovieModel) Update(movie *Movie) error {
 		movie.Version,
 	}
 
-	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-
-	defer cancel()
-
-	err := model.db.QueryRowContext(cntx, query, args...).Scan(&movie.Version)
+	err := db.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -152,14 +721,124 @@ func (model *MovieModel) Update(movie *Movie) error {
 		}
 	}
 
-	return nil
+	err = setMovieCredits(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	err = setMovieExternalIDs(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	err = getMovieCredits(ctx, db, movie)
+	if err != nil {
+		return err
+	}
+
+	return recordMovieRevision(ctx, db, movie, userID)
 }
 
+// Delete moves a movie to the trash, from where it can be restored until it's
+// purged.
 func (model *MovieModel) Delete(id int64) error {
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	return deleteMovie(cntx, model.db, id)
+}
+
+func deleteMovie(ctx context.Context, db queryer, id int64) error {
 	query := `
-        DELETE FROM movies 
-        WHERE id = $1
-    `
+        UPDATE movies
+        SET deleted_at = NOW()
+        WHERE id = $1 AND deleted_at IS NULL`
+
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// MovieTx runs movie queries within a single database transaction, so that
+// several changes are made together or not at all.
+type MovieTx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// Transaction runs fn within a database transaction, which is committed when fn
+// returns nil and rolled back otherwise.
+func (model *MovieModel) Transaction(fn func(tx *MovieTx) error) error {
+	cntx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	defer cancel()
+
+	return withTx(cntx, model.db, func(tx *sql.Tx) error {
+		return fn(&MovieTx{ctx: cntx, tx: tx})
+	})
+}
+
+// Import runs fn within a database transaction like Transaction does, but with
+// a deadline that leaves time for a whole catalog to be streamed in.
+func (model *MovieModel) Import(fn func(tx *MovieTx) error) error {
+	cntx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+
+	defer cancel()
+
+	return withTx(cntx, model.db, func(tx *sql.Tx) error {
+		return fn(&MovieTx{ctx: cntx, tx: tx})
+	})
+}
+
+func (mtx *MovieTx) Insert(movie *Movie, userID int64) error {
+	return insertMovie(mtx.ctx, mtx.tx, movie, userID)
+}
+
+// InsertMany inserts movies in batches of multi-row statements.
+func (mtx *MovieTx) InsertMany(movies []*Movie, userID int64) error {
+	return insertMovies(mtx.ctx, mtx.tx, movies, userID)
+}
+
+func (mtx *MovieTx) Get(id int64) (*Movie, error) {
+	return getMovie(mtx.ctx, mtx.tx, id)
+}
+
+func (mtx *MovieTx) Update(movie *Movie, userID int64) error {
+	return updateMovie(mtx.ctx, mtx.tx, movie, userID)
+}
+
+func (mtx *MovieTx) Delete(id int64) error {
+	return deleteMovie(mtx.ctx, mtx.tx, id)
+}
+
+func (mtx *MovieTx) FindDuplicates(movie *Movie) ([]*MovieDuplicate, error) {
+	return findDuplicateMovies(mtx.ctx, mtx.tx, movie)
+}
+
+// EnsureGenres adds every slug missing from the genre catalog, as
+// GenreModel.EnsureExist does, within the transaction.
+func (mtx *MovieTx) EnsureGenres(slugs []string) error {
+	return ensureGenres(mtx.ctx, mtx.tx, slugs)
+}
+
+// Restore takes a movie back out of the trash.
+func (model *MovieModel) Restore(id int64) error {
+	query := `
+        UPDATE movies
+        SET deleted_at = NULL
+        WHERE id = $1 AND deleted_at IS NOT NULL`
 
 	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 
@@ -181,7 +860,157 @@ func (model *MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func ValidateMovie(v *validator.Validator, input *Movie) {
+// Purge permanently deletes a movie from the trash, and returns the URLs of its
+// images so that their files can be deleted once it's gone.
+func (model *MovieModel) Purge(id int64) ([]string, error) {
+	cntx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+	defer cancel()
+
+	var imageURLs []string
+
+	err := withTx(cntx, model.db, func(tx *sql.Tx) error {
+		var purged int64
+		var err error
+
+		purged, imageURLs, err = purgeMovies(cntx, tx, []int64{id})
+		if err != nil {
+			return err
+		}
+
+		if purged == 0 {
+			return ErrRecordNotFound
+		}
+		return nil
+	})
+
+	return imageURLs, err
+}
+
+// PurgeTrash permanently deletes every movie moved to the trash before the
+// given time, and returns how many were deleted along with the URLs of their
+// images.
+func (model *MovieModel) PurgeTrash(before time.Time) (int64, []string, error) {
+	query := `
+        SELECT id
+        FROM movies
+        WHERE deleted_at < $1`
+
+	cntx, cancel := context.WithTimeout(context.Background(), time.Minute)
+
+	defer cancel()
+
+	var purged int64
+	var imageURLs []string
+
+	err := withTx(cntx, model.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(cntx, query, before)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+
+		for rows.Next() {
+			var id int64
+
+			err = rows.Scan(&id)
+			if err != nil {
+				return err
+			}
+
+			ids = append(ids, id)
+		}
+
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		purged, imageURLs, err = purgeMovies(cntx, tx, ids)
+
+		return err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return purged, imageURLs, nil
+}
+
+// purgeMovies permanently deletes the movies of ids that are in the trash, and
+// returns how many were deleted along with the URLs of their images. The lists
+// they were on are locked beforehand and renumbered afterwards, so that their
+// positions stay gapless.
+func purgeMovies(ctx context.Context, tx *sql.Tx, ids []int64) (int64, []string, error) {
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	listIDs, err := lockMovieLists(ctx, tx, ids)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query := `
+        DELETE FROM movies
+        WHERE id = ANY($1) AND deleted_at IS NOT NULL
+        RETURNING poster_url, poster_thumbnails, backdrop_url, backdrop_thumbnails`
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var purged int64
+	imageURLs := []string{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err = rows.Scan(&movie.PosterURL, &movie.PosterThumbnails, &movie.BackdropURL, &movie.BackdropThumbnails)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		purged++
+		imageURLs = append(imageURLs, movie.ImageURLs(ImagePoster)...)
+		imageURLs = append(imageURLs, movie.ImageURLs(ImageBackdrop)...)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	err = renumberListItems(ctx, tx, listIDs)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return purged, imageURLs, nil
+}
+
+func ValidateMovieQuery(v *validator.Validator, search *MovieQuery) {
+	v.Check(search.YearMin == 0 || search.YearMin >= 1888, "year_min", "must be greater than 1888")
+	v.Check(search.YearMax == 0 || search.YearMax >= 1888, "year_max", "must be greater than 1888")
+	v.Check(search.YearMin == 0 || search.YearMax == 0 || search.YearMin <= search.YearMax, "year_max", "must not be less than year_min")
+
+	v.Check(search.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(search.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(search.RuntimeMin == 0 || search.RuntimeMax == 0 || search.RuntimeMin <= search.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+
+	v.Check(search.CreatedAfter.IsZero() || search.CreatedBefore.IsZero() || search.CreatedAfter.Before(search.CreatedBefore), "created_before", "must be later than created_after")
+
+	v.Check(search.Language == "" || validator.In(search.Language, SearchLanguages...), "language", "must be a supported text search language")
+
+	v.Check(len(search.Genres) <= 5, "genres", "must not contain more than 5")
+	v.Check(len(search.GenresAny) <= 20, "genres_any", "must not contain more than 20")
+}
+
+// ValidateMovie checks a movie. Its genres must all be found in knownGenres,
+// unless knownGenres is nil, in which case any genre is accepted.
+func ValidateMovie(v *validator.Validator, input *Movie, knownGenres []string) {
 	v.Check(input.Title != "", "title", "must be provided")
 	v.Check(len(input.Title) <= 500, "title", "must not be more than 500 bytes long")
 
@@ -197,4 +1026,20 @@ func ValidateMovie(v *validator.Validator, input *Movie) {
 	v.Check(len(input.Genres) < 5, "genres", "must not contain more than 5")
 
 	v.Check(validator.Unique(input.Genres), "genres", "must not contain dublicate values")
+
+	for _, genre := range input.Genres {
+		v.Check(genre != "", "genres", "must not contain empty values")
+
+		if knownGenres != nil {
+			v.Check(validator.In(genre, knownGenres...), "genres", "must only contain genres from the catalog")
+		}
+	}
+
+	validateCredits(v, "directors", input.Directors)
+	validateCredits(v, "cast", input.Cast)
+
+	validateExternalIDs(v, input.ExternalIDs)
+
+	v.Check(input.PosterURL != "" || len(input.PosterThumbnails) == 0, "poster_thumbnails", "must not be provided without a poster_url")
+	v.Check(input.BackdropURL != "" || len(input.BackdropThumbnails) == 0, "backdrop_thumbnails", "must not be provided without a backdrop_url")
 }
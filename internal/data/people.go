@@ -0,0 +1,273 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+type Person struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Biography string    `json:"biography"`
+	Version   int64     `json:"version"`
+}
+
+// FilmographyEntry is a single credit of a person together with the movie it
+// belongs to.
+type FilmographyEntry struct {
+	Role      string `json:"role"`
+	Character string `json:"character,omitempty"`
+	Movie     *Movie `json:"movie"`
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (model *PersonModel) Insert(person *Person) error {
+	query := `
+        INSERT INTO people (name, biography)
+        VALUES ($1, $2)
+        RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return model.DB.QueryRowContext(ctx, query, person.Name, person.Biography).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (model *PersonModel) Get(id int64) (*Person, error) {
+	query := `
+        SELECT id, created_at, name, biography, version
+        FROM people
+        WHERE id = $1`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, id).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.Name,
+		&person.Biography,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (model *PersonModel) GetAll(name string, filters Filters) ([]*Person, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), id, created_at, name, biography, version
+        FROM people
+        WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.Name,
+			&person.Biography,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+// GetExistingIDs reports which of the given person ids belong to existing
+// people.
+func (model *PersonModel) GetExistingIDs(ids []int64) (map[int64]bool, error) {
+	query := `
+        SELECT id
+        FROM people
+        WHERE id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[int64]bool, len(ids))
+
+	for rows.Next() {
+		var id int64
+
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		existing[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+func (model *PersonModel) Update(person *Person) error {
+	query := `
+        UPDATE people
+        SET name = $1, biography = $2, version = version + 1
+        WHERE id = $3 AND version = $4
+        RETURNING version`
+
+	args := []any{person.Name, person.Biography, person.ID, person.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := model.DB.QueryRowContext(ctx, query, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (model *PersonModel) Delete(id int64) error {
+	query := `
+        DELETE FROM people
+        WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (model *PersonModel) GetFilmography(personID int64, filters Filters) ([]*FilmographyEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), movie_credits.role, movie_credits.character,
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        FROM movie_credits
+        INNER JOIN movies ON movies.id = movie_credits.movie_id
+        WHERE movie_credits.person_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, personID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*FilmographyEntry{}
+
+	for rows.Next() {
+		var entry FilmographyEntry
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Role,
+			&entry.Character,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entry.Movie = &movie
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(person.Biography) <= 10_000, "biography", "must not be more than 10000 bytes long")
+}
@@ -0,0 +1,41 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+)
+
+// whereClause collects the conditions of a dynamically built WHERE clause
+// together with their arguments, numbering placeholders as they're added.
+type whereClause struct {
+	conditions []string
+	args       []any
+}
+
+// add appends a condition. The condition is a format string whose verbs
+// receive the placeholder numbers of args, so "year >= $%d" becomes
+// "year >= $3" when two arguments were added before it.
+func (where *whereClause) add(condition string, args ...any) {
+	placeholders := make([]any, len(args))
+
+	for i, arg := range args {
+		where.args = append(where.args, arg)
+		placeholders[i] = len(where.args)
+	}
+
+	where.conditions = append(where.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// arg appends an argument without a condition, for placeholders used outside
+// of the WHERE clause, and returns its placeholder.
+func (where *whereClause) arg(arg any) string {
+	where.args = append(where.args, arg)
+	return fmt.Sprintf("$%d", len(where.args))
+}
+
+func (where *whereClause) String() string {
+	if len(where.conditions) == 0 {
+		return "TRUE"
+	}
+	return strings.Join(where.conditions, " AND ")
+}
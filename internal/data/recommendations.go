@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// maxMovieNeighbors is the number of neighbors kept for each movie.
+	maxMovieNeighbors = 50
+	// minSharedUsers is the number of users two movies must have in common to
+	// be neighbors, so that a single user's taste doesn't pass for a trend.
+	minSharedUsers = 2
+)
+
+// Recommendation sources, telling personal recommendations apart from the
+// popular movies cold-start users get instead.
+const (
+	RecommendationPersonal = "personal"
+	RecommendationPopular  = "popular"
+)
+
+// Recommendation is a movie recommended to a user. The score ranks
+// recommendations from the same source and isn't comparable across sources.
+type Recommendation struct {
+	Score float32 `json:"score"`
+	Movie *Movie  `json:"movie"`
+}
+
+type RecommendationModel struct {
+	DB *sql.DB
+}
+
+// unseenCondition leaves out the movies the user in $1 has already watched or
+// reviewed.
+const unseenCondition = `
+        NOT EXISTS (SELECT 1 FROM watched_movies WHERE watched_movies.user_id = $1 AND watched_movies.movie_id = movies.id)
+        AND NOT EXISTS (SELECT 1 FROM reviews WHERE reviews.user_id = $1 AND reviews.movie_id = movies.id)`
+
+// personalRecommendations scores the neighbors of every movie the user in $1
+// has shown an interest in by the sum of their scores, so that movies close to
+// several of them come first.
+const personalRecommendations = `
+        FROM movie_interactions
+        INNER JOIN movie_neighbors ON movie_neighbors.movie_id = movie_interactions.movie_id
+        INNER JOIN movies ON movies.id = movie_neighbors.neighbor_id
+        WHERE movie_interactions.user_id = $1 AND movies.deleted_at IS NULL AND` + unseenCondition
+
+// GetForUser returns the page of recommendations for userID, along with their
+// source. Users whose ratings and watch history yield no recommendations get
+// the most popular movies they haven't seen, narrowed down to genres when any
+// are given.
+func (model *RecommendationModel) GetForUser(userID int64, genres []string, filters Filters) ([]*Recommendation, string, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), sum(movie_neighbors.score),
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        %s
+        GROUP BY movies.id
+        ORDER BY 2 DESC, movies.id
+        LIMIT $2 OFFSET $3`, personalRecommendations)
+
+	recommendations, metadata, err := model.query(ctx, query, filters, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, "", Metadata{}, err
+	}
+
+	if len(recommendations) > 0 {
+		return recommendations, RecommendationPersonal, metadata, nil
+	}
+
+	// An empty page can still be past the end of the personal
+	// recommendations, in which case the user isn't a cold-start one.
+	if filters.Page > 1 {
+		query = fmt.Sprintf(`SELECT count(DISTINCT movies.id) %s`, personalRecommendations)
+
+		var total int
+
+		err = model.DB.QueryRowContext(ctx, query, userID).Scan(&total)
+		if err != nil {
+			return nil, "", Metadata{}, err
+		}
+
+		if total > 0 {
+			return recommendations, RecommendationPersonal, calculateMetadata(total, filters.Page, filters.PageSize), nil
+		}
+	}
+
+	// Popularity weighs the average rating by the number of ratings, so that a
+	// single perfect score doesn't top the list.
+	query = fmt.Sprintf(`
+        SELECT count(*) OVER(), movies.average_rating * movies.rating_count / (movies.rating_count + 10.0),
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        FROM movies
+        WHERE movies.deleted_at IS NULL AND (COALESCE(cardinality($4::text[]), 0) = 0 OR movies.genres && $4) AND %s
+        ORDER BY 2 DESC, movies.id
+        LIMIT $2 OFFSET $3`, unseenCondition)
+
+	recommendations, metadata, err = model.query(ctx, query, filters, userID, filters.limit(), filters.offset(), pq.Array(genres))
+	if err != nil {
+		return nil, "", Metadata{}, err
+	}
+
+	return recommendations, RecommendationPopular, metadata, nil
+}
+
+func (model *RecommendationModel) query(ctx context.Context, query string, filters Filters, args ...any) ([]*Recommendation, Metadata, error) {
+	rows, err := model.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	recommendations := []*Recommendation{}
+
+	for rows.Next() {
+		var recommendation Recommendation
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&recommendation.Score,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		recommendation.Movie = &movie
+		recommendations = append(recommendations, &recommendation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return recommendations, metadata, nil
+}
+
+// RefreshNeighbors recomputes the neighbors of up to limit movies, taken in id
+// order from the first one after afterID. It returns the id of the last movie
+// refreshed, which is zero once every movie has been.
+//
+// Two movies are scored by the cosine similarity of the users interested in
+// them: the number of users they share over the geometric mean of the number
+// of users of each.
+func (model *RecommendationModel) RefreshNeighbors(afterID int64, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var lastID int64
+
+	err := withTx(ctx, model.DB, func(tx *sql.Tx) error {
+		ids, err := nextMovieIDs(ctx, tx, afterID, limit)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		query := `
+            DELETE FROM movie_neighbors
+            WHERE movie_id = ANY($1)`
+
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		query = `
+            WITH pairs AS (
+                SELECT movie.movie_id, other.movie_id AS neighbor_id, count(*) AS shared
+                FROM movie_interactions AS movie
+                INNER JOIN movie_interactions AS other ON other.user_id = movie.user_id AND other.movie_id <> movie.movie_id
+                WHERE movie.movie_id = ANY($1)
+                GROUP BY movie.movie_id, other.movie_id
+                HAVING count(*) >= $3
+            ), users AS (
+                SELECT movie_id, count(*) AS total
+                FROM movie_interactions
+                WHERE movie_id IN (SELECT movie_id FROM pairs UNION SELECT neighbor_id FROM pairs)
+                GROUP BY movie_id
+            ), ranked AS (
+                SELECT pairs.movie_id, pairs.neighbor_id, pairs.shared / sqrt(movie.total * neighbor.total) AS score,
+                    row_number() OVER (PARTITION BY pairs.movie_id ORDER BY pairs.shared / sqrt(movie.total * neighbor.total) DESC, pairs.neighbor_id) AS rank
+                FROM pairs
+                INNER JOIN users AS movie ON movie.movie_id = pairs.movie_id
+                INNER JOIN users AS neighbor ON neighbor.movie_id = pairs.neighbor_id
+            )
+            INSERT INTO movie_neighbors (movie_id, neighbor_id, score)
+            SELECT movie_id, neighbor_id, score
+            FROM ranked
+            WHERE rank <= $2`
+
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids), maxMovieNeighbors, minSharedUsers)
+		if err != nil {
+			return err
+		}
+
+		lastID = ids[len(ids)-1]
+
+		return nil
+	})
+
+	return lastID, err
+}
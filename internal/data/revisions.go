@@ -0,0 +1,319 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieSnapshot is the editable state of a movie at a given version.
+type MovieSnapshot struct {
+	Title       string      `json:"title"`
+	Year        int32       `json:"year"`
+	Runtime     Runtime     `json:"runtime"`
+	Genres      []string    `json:"genres"`
+	Directors   []Credit    `json:"directors"`
+	Cast        []Credit    `json:"cast"`
+	ExternalIDs ExternalIDs `json:"external_ids"`
+}
+
+// RevisionChange holds the values of a field before and after a revision. From
+// is null for fields set by the first recorded revision.
+type RevisionChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+type MovieRevision struct {
+	MovieID   int64                     `json:"movie_id"`
+	Version   int64                     `json:"version"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UserID    int64                     `json:"user_id,omitempty"`
+	Movie     *MovieSnapshot            `json:"movie"`
+	Changes   map[string]RevisionChange `json:"changes"`
+}
+
+type MovieRevisionModel struct {
+	DB *sql.DB
+}
+
+func snapshotMovie(movie *Movie) *MovieSnapshot {
+	return &MovieSnapshot{
+		Title:       movie.Title,
+		Year:        movie.Year,
+		Runtime:     movie.Runtime,
+		Genres:      movie.Genres,
+		Directors:   movie.Directors,
+		Cast:        movie.Cast,
+		ExternalIDs: nonNilExternalIDs(movie.ExternalIDs),
+	}
+}
+
+// nonNilExternalIDs returns ids, or an empty map when it's nil. Snapshots always
+// hold a map, since a nil one would leave the ids untouched when applied.
+func nonNilExternalIDs(ids ExternalIDs) ExternalIDs {
+	if ids == nil {
+		return ExternalIDs{}
+	}
+
+	return ids
+}
+
+// Apply copies the snapshot onto a movie, leaving its id and version alone. The
+// movie's external ids are replaced even when the snapshot has none, which is
+// also the case of snapshots recorded before movies had any.
+func (snapshot *MovieSnapshot) Apply(movie *Movie) {
+	movie.Title = snapshot.Title
+	movie.Year = snapshot.Year
+	movie.Runtime = snapshot.Runtime
+	movie.Genres = snapshot.Genres
+	movie.Directors = snapshot.Directors
+	movie.Cast = snapshot.Cast
+	movie.ExternalIDs = nonNilExternalIDs(snapshot.ExternalIDs)
+}
+
+// diffSnapshots returns the fields whose JSON encoding differs between two
+// snapshots. A nil previous snapshot reports every field as changed.
+func diffSnapshots(previous, current *MovieSnapshot) (map[string]RevisionChange, error) {
+	var from, to map[string]json.RawMessage
+
+	if previous != nil {
+		js, err := json.Marshal(previous)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(js, &from)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	js, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(js, &to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]RevisionChange)
+
+	for field, value := range to {
+		old, ok := from[field]
+		if !ok {
+			old = json.RawMessage("null")
+		}
+
+		if !bytes.Equal(old, value) {
+			changes[field] = RevisionChange{From: old, To: value}
+		}
+	}
+
+	return changes, nil
+}
+
+// recordMovieRevision stores the current state of a movie as the revision for
+// its version, along with what changed since the previous recorded revision.
+// The movie's credits must be loaded.
+func recordMovieRevision(ctx context.Context, tx queryer, movie *Movie, userID int64) error {
+	var previous *MovieSnapshot
+	var js []byte
+
+	query := `
+        SELECT snapshot
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY version DESC
+        LIMIT 1`
+
+	err := tx.QueryRowContext(ctx, query, movie.ID).Scan(&js)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return err
+	default:
+		previous = &MovieSnapshot{}
+
+		err = json.Unmarshal(js, previous)
+		if err != nil {
+			return err
+		}
+
+		previous.ExternalIDs = nonNilExternalIDs(previous.ExternalIDs)
+	}
+
+	snapshot := snapshotMovie(movie)
+
+	changes, err := diffSnapshots(previous, snapshot)
+	if err != nil {
+		return err
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	query = `
+        INSERT INTO movie_revisions (movie_id, version, user_id, snapshot, changes)
+        VALUES ($1, $2, $3, $4, $5)`
+
+	args := []any{movie.ID, movie.Version, sql.NullInt64{Int64: userID, Valid: userID > 0}, string(snapshotJSON), string(changesJSON)}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// recordNewMovieRevisions stores the first revision of newly inserted movies
+// with a single statement. The movies' credits must be loaded.
+func recordNewMovieRevisions(ctx context.Context, db queryer, movies []*Movie, userID int64) error {
+	movieIDs := make([]int64, len(movies))
+	versions := make([]int64, len(movies))
+	snapshots := make([]string, len(movies))
+	changes := make([]string, len(movies))
+
+	for i, movie := range movies {
+		snapshot := snapshotMovie(movie)
+
+		movieChanges, err := diffSnapshots(nil, snapshot)
+		if err != nil {
+			return err
+		}
+
+		snapshotJSON, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		changesJSON, err := json.Marshal(movieChanges)
+		if err != nil {
+			return err
+		}
+
+		movieIDs[i], versions[i] = movie.ID, movie.Version
+		snapshots[i], changes[i] = string(snapshotJSON), string(changesJSON)
+	}
+
+	query := `
+        INSERT INTO movie_revisions (movie_id, version, user_id, snapshot, changes)
+        SELECT movie_id, version, $3::bigint, snapshot::jsonb, changes::jsonb
+        FROM unnest($1::bigint[], $2::bigint[], $4::text[], $5::text[]) AS revisions(movie_id, version, snapshot, changes)`
+
+	args := []any{pq.Array(movieIDs), pq.Array(versions), sql.NullInt64{Int64: userID, Valid: userID > 0}, pq.Array(snapshots), pq.Array(changes)}
+
+	_, err := db.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+func (model *MovieRevisionModel) Get(movieID, version int64) (*MovieRevision, error) {
+	query := `
+        SELECT movie_id, version, created_at, user_id, snapshot, changes
+        FROM movie_revisions
+        WHERE movie_id = $1 AND version = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revision, err := scanMovieRevision(model.DB.QueryRowContext(ctx, query, movieID, version))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return revision, nil
+}
+
+func (model *MovieRevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	// Revisions are only sorted by version, which is unique within a movie,
+	// so they're ordered by it directly rather than with orderBy and its
+	// tiebreaker.
+	order := filters.sortFields(nil)[0]
+
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), movie_id, version, created_at, user_id, snapshot, changes
+        FROM movie_revisions
+        WHERE movie_id = $1
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, order.column+" "+order.direction)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*MovieRevision{}
+
+	for rows.Next() {
+		revision, err := scanMovieRevision(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// scanMovieRevision scans a movie_revisions row, after any leading columns
+// given in dest.
+func scanMovieRevision(row interface{ Scan(...any) error }, dest ...any) (*MovieRevision, error) {
+	var revision MovieRevision
+	var userID sql.NullInt64
+	var snapshot, changes []byte
+
+	dest = append(dest, &revision.MovieID, &revision.Version, &revision.CreatedAt, &userID, &snapshot, &changes)
+
+	err := row.Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.UserID = userID.Int64
+	revision.Movie = &MovieSnapshot{}
+
+	err = json.Unmarshal(snapshot, revision.Movie)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Movie.ExternalIDs = nonNilExternalIDs(revision.Movie.ExternalIDs)
+
+	err = json.Unmarshal(changes, &revision.Changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
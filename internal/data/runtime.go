@@ -25,18 +25,23 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 		return ErrInvalidRuntimeFormat
 	}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+	*r, err = ParseRuntime(unquotedJSONValue)
+
+	return err
+}
+
+// ParseRuntime parses a runtime in the "<runtime> mins" format used in JSON.
+func ParseRuntime(s string) (Runtime, error) {
+	parts := strings.Split(s, " ")
 
 	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
 	i, err := strconv.ParseInt(parts[0], 10, 32)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
-	*r = Runtime(i)
-
-	return nil
+	return Runtime(i), nil
 }
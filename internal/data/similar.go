@@ -0,0 +1,185 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxSimilarMovies is the number of similar movies kept for each movie.
+const maxSimilarMovies = 100
+
+// similarSortColumns maps sort values accepted by similar movie listings to the
+// columns they order by.
+var similarSortColumns = map[string]string{
+	"id":    "movies.id",
+	"score": "movie_similarity.score",
+	"title": "movies.title",
+	"year":  "movies.year",
+}
+
+// SimilarMovie is a movie recommended from another one. Score runs from 0 to 1,
+// higher being more similar.
+type SimilarMovie struct {
+	Score float32 `json:"score"`
+	Movie *Movie  `json:"movie"`
+}
+
+func (model *MovieModel) GetSimilar(id int64, filters Filters) ([]*SimilarMovie, Metadata, error) {
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), movie_similarity.score,
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        FROM movie_similarity
+        INNER JOIN movies ON movies.id = movie_similarity.similar_id
+        WHERE movie_similarity.movie_id = $1 AND movies.deleted_at IS NULL
+        ORDER BY %s
+        LIMIT $2 OFFSET $3`, filters.orderBy(similarSortColumns))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.db.QueryContext(ctx, query, id, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	similar := []*SimilarMovie{}
+
+	for rows.Next() {
+		var entry SimilarMovie
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Score,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entry.Movie = &movie
+		similar = append(similar, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return similar, metadata, nil
+}
+
+// RefreshSimilar recomputes the similar movies of up to limit movies, taken in
+// id order from the first one after afterID. It returns the id of the last
+// movie refreshed, which is zero once every movie has been.
+//
+// Movies are scored by the Jaccard index of their genres, weighted 0.6, how
+// close their years are, weighted 0.25 and reaching zero 20 years apart, and
+// the trigram similarity of their titles, weighted 0.15. Only movies sharing at
+// least one genre are scored, which keeps the genres index in play.
+func (model *MovieModel) RefreshSimilar(afterID int64, limit int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var lastID int64
+
+	err := withTx(ctx, model.db, func(tx *sql.Tx) error {
+		ids, err := nextMovieIDs(ctx, tx, afterID, limit)
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		query := `
+            DELETE FROM movie_similarity
+            WHERE movie_id = ANY($1)`
+
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		query = `
+            INSERT INTO movie_similarity (movie_id, similar_id, score)
+            SELECT movie.id, similar.id, similar.score
+            FROM movies AS movie
+            CROSS JOIN LATERAL (
+                SELECT other.id,
+                    0.6 * cardinality(ARRAY(SELECT unnest(movie.genres) INTERSECT SELECT unnest(other.genres)))::real
+                        / cardinality(ARRAY(SELECT unnest(movie.genres) UNION SELECT unnest(other.genres)))
+                    + 0.25 * greatest(0, 1 - abs(movie.year - other.year) / 20.0)
+                    + 0.15 * similarity(movie.title, other.title) AS score
+                FROM movies AS other
+                WHERE other.id <> movie.id AND other.deleted_at IS NULL AND other.genres && movie.genres
+                ORDER BY score DESC, other.id
+                LIMIT $2
+            ) AS similar
+            WHERE movie.id = ANY($1)`
+
+		_, err = tx.ExecContext(ctx, query, pq.Array(ids), maxSimilarMovies)
+		if err != nil {
+			return err
+		}
+
+		lastID = ids[len(ids)-1]
+
+		return nil
+	})
+
+	return lastID, err
+}
+
+// nextMovieIDs returns the ids of up to limit movies outside the trash, taken
+// in id order from the first one after afterID.
+func nextMovieIDs(ctx context.Context, db queryer, afterID int64, limit int) ([]int64, error) {
+	query := `
+        SELECT id
+        FROM movies
+        WHERE id > $1 AND deleted_at IS NULL
+        ORDER BY id
+        LIMIT $2`
+
+	rows, err := db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieStats sums up the movies matching a MovieQuery. Genres are listed most
+// common first, years and decades in chronological order.
+type MovieStats struct {
+	Total         int           `json:"total"`
+	Genres        []FacetCount  `json:"genres"`
+	Years         []FacetCount  `json:"years"`
+	Decades       []FacetCount  `json:"decades"`
+	Runtime       RuntimeStats  `json:"runtime"`
+	RecentlyAdded RecentlyAdded `json:"recently_added"`
+	GeneratedAt   time.Time     `json:"generated_at"`
+}
+
+// RuntimeStats describes the distribution of movie runtimes. It's all zeros
+// when no movies match.
+type RuntimeStats struct {
+	Min     Runtime `json:"min"`
+	P25     Runtime `json:"p25"`
+	Median  Runtime `json:"median"`
+	P75     Runtime `json:"p75"`
+	P90     Runtime `json:"p90"`
+	Max     Runtime `json:"max"`
+	Average float64 `json:"average"`
+}
+
+// RecentlyAdded counts the movies added to the catalog within the last day,
+// week and 30 days.
+type RecentlyAdded struct {
+	LastDay   int `json:"last_day"`
+	LastWeek  int `json:"last_week"`
+	LastMonth int `json:"last_month"`
+}
+
+func (model *MovieModel) GetStats(search MovieQuery) (*MovieStats, error) {
+	facets, err := model.GetFacets(search, []string{"genres", "year", "decade"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, facet := range []string{"year", "decade"} {
+		slices.SortFunc(facets[facet], func(a, b FacetCount) int {
+			return strings.Compare(a.Value, b.Value)
+		})
+	}
+
+	stats := &MovieStats{
+		Genres:      facets["genres"],
+		Years:       facets["year"],
+		Decades:     facets["decade"],
+		GeneratedAt: time.Now(),
+	}
+
+	where := search.where()
+
+	query := fmt.Sprintf(`
+        SELECT count(*),
+            COALESCE(min(runtime), 0),
+            COALESCE(percentile_disc(ARRAY[0.25, 0.5, 0.75, 0.9]) WITHIN GROUP (ORDER BY runtime), ARRAY[0, 0, 0, 0]),
+            COALESCE(max(runtime), 0),
+            COALESCE(avg(runtime), 0)::double precision,
+            count(*) FILTER (WHERE created_at > NOW() - INTERVAL '1 day'),
+            count(*) FILTER (WHERE created_at > NOW() - INTERVAL '7 days'),
+            count(*) FILTER (WHERE created_at > NOW() - INTERVAL '30 days')
+        FROM movies
+        WHERE %s`, where)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var percentiles []int64
+
+	err = model.db.QueryRowContext(ctx, query, where.args...).Scan(
+		&stats.Total,
+		&stats.Runtime.Min,
+		pq.Array(&percentiles),
+		&stats.Runtime.Max,
+		&stats.Runtime.Average,
+		&stats.RecentlyAdded.LastDay,
+		&stats.RecentlyAdded.LastWeek,
+		&stats.RecentlyAdded.LastMonth,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(percentiles) == 4 {
+		stats.Runtime.P25 = Runtime(percentiles[0])
+		stats.Runtime.Median = Runtime(percentiles[1])
+		stats.Runtime.P75 = Runtime(percentiles[2])
+		stats.Runtime.P90 = Runtime(percentiles[3])
+	}
+
+	return stats, nil
+}
@@ -16,13 +16,13 @@ var ErrDuplicateEmail = errors.New("duplicate email")
 var AnonymousUser = &User{}
 
 type User struct {
-	ID        int64     `json: "id"`
-	CreatedAt time.Time `json: "created_at"`
-	Name      string    `json: "name"`
-	Email     string    `json: "email"`
-	Password  password  `json: "-"`
-	Activated bool      `json: "activated"`
-	Version   int       `json: "-"`
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	Version   int       `json:"-"`
 }
 
 type UserModel struct {
@@ -0,0 +1,298 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"greenlight.nesty.net/internal/validator"
+)
+
+// topGenresLimit is the number of genres listed in watch history stats.
+const topGenresLimit = 5
+
+// watchHistorySortColumns maps sort values accepted by the watch history to the
+// columns they order by.
+var watchHistorySortColumns = map[string]string{
+	"id":         "movies.id",
+	"watched_at": "max(watched_movies.watched_at)",
+	"title":      "movies.title",
+	"year":       "movies.year",
+}
+
+// WatchedMovie is a movie a user has marked as watched. Every viewing is stored,
+// but a movie is only listed once per user, with its latest viewing as
+// WatchedAt and the number of earlier ones as RewatchCount.
+type WatchedMovie struct {
+	WatchedAt    time.Time `json:"watched_at"`
+	RewatchCount int32     `json:"rewatch_count"`
+	Movie        *Movie    `json:"movie"`
+}
+
+// WatchHistoryQuery narrows the watch history down to the viewings within a
+// period. Zero values leave the matching bound out.
+type WatchHistoryQuery struct {
+	WatchedAfter  time.Time
+	WatchedBefore time.Time
+}
+
+// WatchStats sums up the viewings in a watch history. Rewatches count towards
+// the watches and runtime, at the time they were watched.
+type WatchStats struct {
+	Movies    int          `json:"movies"`
+	Watches   int          `json:"watches"`
+	Runtime   Runtime      `json:"runtime"`
+	TopGenres []FacetCount `json:"top_genres"`
+}
+
+type WatchHistoryModel struct {
+	DB *sql.DB
+}
+
+// where builds the WHERE clause shared by the queries over the viewings of
+// userID, which must be the first argument. Movies in the trash are left out.
+func (search *WatchHistoryQuery) where(userID int64) *whereClause {
+	where := &whereClause{}
+
+	where.add("watched_movies.user_id = $%d", userID)
+	where.add("movies.deleted_at IS NULL")
+
+	if !search.WatchedAfter.IsZero() {
+		where.add("watched_movies.watched_at >= $%d", search.WatchedAfter)
+	}
+	if !search.WatchedBefore.IsZero() {
+		where.add("watched_movies.watched_at < $%d", search.WatchedBefore)
+	}
+
+	return where
+}
+
+// Record adds a viewing of the movie of watched by userID at its WatchedAt
+// time, which counts as a rewatch when the user had already watched it. When
+// rewatchCount is given, the number of viewings is set to match it outright:
+// missing ones are added at the same time, since their dates are unknown, and
+// extra ones are removed from the earliest on. The latest viewing and the
+// resulting count are stored in watched.
+func (model *WatchHistoryModel) Record(userID int64, watched *WatchedMovie, rewatchCount *int32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return withTx(ctx, model.DB, func(tx *sql.Tx) error {
+		// Lock the user so that concurrent changes to their viewings can't
+		// both adjust the same rewatch count.
+		var id int64
+
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		query := `
+            INSERT INTO watched_movies (user_id, movie_id, watched_at)
+            VALUES ($1, $2, $3)
+            RETURNING id`
+
+		var viewingID int64
+
+		err = tx.QueryRowContext(ctx, query, userID, watched.Movie.ID, watched.WatchedAt).Scan(&viewingID)
+		if err != nil {
+			return err
+		}
+
+		if rewatchCount != nil {
+			query = `
+                INSERT INTO watched_movies (user_id, movie_id, watched_at)
+                SELECT $1, $2, $3
+                FROM generate_series(1, $4::integer + 1 - (SELECT count(*) FROM watched_movies WHERE user_id = $1 AND movie_id = $2))`
+
+			_, err = tx.ExecContext(ctx, query, userID, watched.Movie.ID, watched.WatchedAt, *rewatchCount)
+			if err != nil {
+				return err
+			}
+
+			query = `
+                DELETE FROM watched_movies
+                WHERE id IN (
+                    SELECT id
+                    FROM watched_movies
+                    WHERE user_id = $1 AND movie_id = $2 AND id <> $3
+                    ORDER BY watched_at, id
+                    LIMIT GREATEST(0, (SELECT count(*) FROM watched_movies WHERE user_id = $1 AND movie_id = $2) - ($4::integer + 1))
+                )`
+
+			_, err = tx.ExecContext(ctx, query, userID, watched.Movie.ID, viewingID, *rewatchCount)
+			if err != nil {
+				return err
+			}
+		}
+
+		query = `
+            SELECT max(watched_at), count(*) - 1
+            FROM watched_movies
+            WHERE user_id = $1 AND movie_id = $2`
+
+		return tx.QueryRowContext(ctx, query, userID, watched.Movie.ID).Scan(&watched.WatchedAt, &watched.RewatchCount)
+	})
+}
+
+// Delete takes a movie out of the watch history of userID, along with every
+// viewing of it.
+func (model *WatchHistoryModel) Delete(userID, movieID int64) error {
+	query := `
+        DELETE FROM watched_movies
+        WHERE user_id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := model.DB.ExecContext(ctx, query, userID, movieID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (model *WatchHistoryModel) GetAllForUser(userID int64, search WatchHistoryQuery, filters Filters) ([]*WatchedMovie, Metadata, error) {
+	where := search.where(userID)
+
+	limit, offset := where.arg(filters.limit()), where.arg(filters.offset())
+
+	// Movies are listed with their latest viewing within the period, while
+	// the rewatch count covers every viewing.
+	query := fmt.Sprintf(`
+        SELECT count(*) OVER(), max(watched_movies.watched_at),
+            (SELECT count(*) - 1 FROM watched_movies AS viewings WHERE viewings.user_id = $1 AND viewings.movie_id = movies.id),
+            movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+            movies.average_rating, movies.rating_count, movies.version
+        FROM watched_movies
+        INNER JOIN movies ON movies.id = watched_movies.movie_id
+        WHERE %s
+        GROUP BY movies.id
+        ORDER BY %s
+        LIMIT %s OFFSET %s`, where, filters.orderBy(watchHistorySortColumns), limit, offset)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := model.DB.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	history := []*WatchedMovie{}
+
+	for rows.Next() {
+		var watched WatchedMovie
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&watched.WatchedAt,
+			&watched.RewatchCount,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		watched.Movie = &movie
+		history = append(history, &watched)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return history, metadata, nil
+}
+
+// GetStats sums up the watch history of userID matching search.
+func (model *WatchHistoryModel) GetStats(userID int64, search WatchHistoryQuery) (*WatchStats, error) {
+	where := search.where(userID)
+
+	query := fmt.Sprintf(`
+        SELECT count(DISTINCT movies.id), count(*), COALESCE(sum(movies.runtime), 0)
+        FROM watched_movies
+        INNER JOIN movies ON movies.id = watched_movies.movie_id
+        WHERE %s`, where)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stats := &WatchStats{TopGenres: []FacetCount{}}
+
+	err := model.DB.QueryRowContext(ctx, query, where.args...).Scan(&stats.Movies, &stats.Watches, &stats.Runtime)
+	if err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`
+        SELECT genre, count(DISTINCT movies.id)
+        FROM watched_movies
+        INNER JOIN movies ON movies.id = watched_movies.movie_id, unnest(movies.genres) AS genre
+        WHERE %s
+        GROUP BY genre
+        ORDER BY 2 DESC, genre
+        LIMIT %d`, where, topGenresLimit)
+
+	rows, err := model.DB.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var count FacetCount
+
+		err := rows.Scan(&count.Value, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.TopGenres = append(stats.TopGenres, count)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func ValidateWatchedMovie(v *validator.Validator, watched *WatchedMovie, rewatchCount *int32) {
+	v.Check(!watched.WatchedAt.After(time.Now()), "watched_at", "must not be in the future")
+	v.Check(watched.WatchedAt.Year() >= 1888, "watched_at", "must be later than 1888")
+
+	if rewatchCount != nil {
+		v.Check(*rewatchCount >= 0, "rewatch_count", "must not be negative")
+		v.Check(*rewatchCount <= 10_000, "rewatch_count", "must not be more than 10000")
+	}
+}
+
+func ValidateWatchHistoryQuery(v *validator.Validator, search *WatchHistoryQuery) {
+	v.Check(search.WatchedAfter.IsZero() || search.WatchedBefore.IsZero() || search.WatchedAfter.Before(search.WatchedBefore), "watched_before", "must be later than watched_after")
+}
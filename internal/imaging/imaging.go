@@ -0,0 +1,68 @@
+// Package imaging resizes images without dependencies outside the standard
+// library.
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resize scales img to the given width, keeping its aspect ratio. Each pixel of
+// the result is the average of the pixels it covers in img, and transparent
+// areas are flattened onto a white background. Images no wider than width are
+// only flattened.
+func Resize(img image.Image, width int) *image.RGBA {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	if width > srcWidth {
+		width = srcWidth
+	}
+
+	height := max(1, srcHeight*width/srcWidth)
+
+	src, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := max(y0+1, (y+1)*srcHeight/height)
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := max(x0+1, (x+1)*srcWidth/width)
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[offset])
+					g += uint64(src.Pix[offset+1])
+					b += uint64(src.Pix[offset+2])
+					a += uint64(src.Pix[offset+3])
+					n++
+					offset += 4
+				}
+			}
+
+			// The RGBA pixels are alpha-premultiplied, so flattening onto
+			// white only needs the missing coverage added to each channel.
+			white := 255*n - a
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8((r + white) / n)
+			dst.Pix[offset+1] = uint8((g + white) / n)
+			dst.Pix[offset+2] = uint8((b + white) / n)
+			dst.Pix[offset+3] = 255
+		}
+	}
+
+	return dst
+}
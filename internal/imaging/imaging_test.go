@@ -0,0 +1,94 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// uniform returns a width by height image filled with c.
+func uniform(width, height int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestResizeBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		width      int
+		wantWidth  int
+		wantHeight int
+	}{
+		{"keeps the aspect ratio", uniform(400, 600, color.Black), 200, 200, 300},
+		{"rounds the height down", uniform(3, 2, color.Black), 2, 2, 1},
+		{"keeps at least one row", uniform(1000, 1, color.Black), 10, 10, 1},
+		{"doesn't enlarge", uniform(100, 50, color.Black), 300, 100, 50},
+		{"keeps the same width", uniform(100, 50, color.Black), 100, 100, 50},
+		{"starts the result at the origin", uniform(40, 40, color.Black).SubImage(image.Rect(10, 20, 30, 40)), 10, 10, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resize(tt.img, tt.width).Bounds()
+
+			want := image.Rect(0, 0, tt.wantWidth, tt.wantHeight)
+			if got != want {
+				t.Errorf("got bounds %v; want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestResizePixels(t *testing.T) {
+	checkerboard := image.NewGray(image.Rect(0, 0, 2, 2))
+	checkerboard.SetGray(0, 0, color.Gray{Y: 255})
+	checkerboard.SetGray(1, 1, color.Gray{Y: 255})
+
+	halves := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				halves.Set(x, y, color.RGBA{R: 200, A: 255})
+			} else {
+				halves.Set(x, y, color.RGBA{B: 100, A: 255})
+			}
+		}
+	}
+
+	offset := uniform(4, 4, color.White)
+	offset.Set(2, 2, color.RGBA{G: 60, A: 255})
+
+	tests := []struct {
+		name  string
+		img   image.Image
+		width int
+		x, y  int
+		want  color.RGBA
+	}{
+		{"keeps opaque colors", uniform(2, 2, color.RGBA{R: 10, G: 20, B: 30, A: 255}), 2, 1, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255}},
+		{"averages the covered pixels", checkerboard, 1, 0, 0, color.RGBA{R: 127, G: 127, B: 127, A: 255}},
+		{"averages each side separately", halves, 2, 0, 0, color.RGBA{R: 200, A: 255}},
+		{"averages the other side separately", halves, 2, 1, 0, color.RGBA{B: 100, A: 255}},
+		{"flattens transparency onto white", uniform(2, 2, color.Transparent), 2, 0, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+		{"flattens translucency onto white", uniform(1, 1, color.NRGBA{A: 128}), 1, 0, 0, color.RGBA{R: 127, G: 127, B: 127, A: 255}},
+		{"reads sub-images from their bounds", offset.SubImage(image.Rect(2, 2, 3, 3)), 1, 0, 0, color.RGBA{G: 60, A: 255}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resize(tt.img, tt.width).RGBAAt(tt.x, tt.y)
+
+			if got != tt.want {
+				t.Errorf("got pixel %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
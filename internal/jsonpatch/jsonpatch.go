@@ -0,0 +1,444 @@
+// Package jsonpatch applies RFC 7396 JSON Merge Patch and RFC 6902 JSON Patch
+// documents to JSON values.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDocument = errors.New("jsonpatch: invalid JSON document")
+
+// Operation is a single RFC 6902 patch operation. Value is nil when the
+// operation doesn't carry a value.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// OperationError reports which operation of a JSON Patch couldn't be applied.
+type OperationError struct {
+	Index int
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d: %s", e.Index, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc and returns the patched
+// document.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, ErrInvalidDocument
+	}
+
+	changes, err := decode(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target any, patch any) any {
+	changes, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(object, key)
+			continue
+		}
+		object[key] = merge(object[key], value)
+	}
+
+	return object
+}
+
+// Apply applies the operations of an RFC 6902 patch to doc in order and returns
+// the patched document. When an operation fails, the returned error is an
+// *OperationError and none of the operations take effect.
+func Apply(doc []byte, operations []Operation) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, ErrInvalidDocument
+	}
+
+	for i, operation := range operations {
+		target, err = apply(target, operation)
+		if err != nil {
+			return nil, &OperationError{Index: i, Err: err}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func apply(doc any, operation Operation) (any, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%q operation requires a value", operation.Op)
+		}
+
+		value, err := decode(operation.Value)
+		if err != nil {
+			return nil, errors.New("value must be valid JSON")
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(doc, path, operation.Path, value)
+		case "replace":
+			return replace(doc, path, operation.Path, value)
+		default:
+			current, err := get(doc, path, operation.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("value at path %q does not match", operation.Path)
+			}
+			return doc, nil
+		}
+	case "remove":
+		return remove(doc, path, operation.Path)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from, operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "move" {
+			if operation.Path == operation.From {
+				return doc, nil
+			}
+			if strings.HasPrefix(operation.Path, operation.From+"/") {
+				return nil, fmt.Errorf("path %q cannot be moved into one of its children", operation.From)
+			}
+
+			doc, err = remove(doc, from, operation.From)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+
+		return add(doc, path, operation.Path, value)
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", operation.Op)
+	}
+}
+
+func get(node any, tokens []string, path string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, notFound(path)
+			}
+			node = child
+		case []any:
+			i, err := index(token, len(n)-1, path)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, notFound(path)
+		}
+	}
+
+	return node, nil
+}
+
+func add(node any, tokens []string, path string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		if len(tokens) == 1 {
+			n[tokens[0]] = value
+			return n, nil
+		}
+
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, notFound(path)
+		}
+
+		child, err := add(child, tokens[1:], path, value)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+
+		return n, nil
+	case []any:
+		if len(tokens) == 1 {
+			i := len(n)
+			if tokens[0] != "-" {
+				var err error
+				i, err = index(tokens[0], len(n), path)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+
+			return n, nil
+		}
+
+		i, err := index(tokens[0], len(n)-1, path)
+		if err != nil {
+			return nil, err
+		}
+
+		n[i], err = add(n[i], tokens[1:], path, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return n, nil
+	default:
+		return nil, notFound(path)
+	}
+}
+
+func replace(node any, tokens []string, path string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, notFound(path)
+		}
+
+		child, err := replace(child, tokens[1:], path, value)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+
+		return n, nil
+	case []any:
+		i, err := index(tokens[0], len(n)-1, path)
+		if err != nil {
+			return nil, err
+		}
+
+		n[i], err = replace(n[i], tokens[1:], path, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return n, nil
+	default:
+		return nil, notFound(path)
+	}
+}
+
+func remove(node any, tokens []string, path string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("the document root cannot be removed")
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, notFound(path)
+		}
+
+		if len(tokens) == 1 {
+			delete(n, tokens[0])
+			return n, nil
+		}
+
+		child, err := remove(child, tokens[1:], path)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = child
+
+		return n, nil
+	case []any:
+		i, err := index(tokens[0], len(n)-1, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tokens) == 1 {
+			return append(n[:i], n[i+1:]...), nil
+		}
+
+		n[i], err = remove(n[i], tokens[1:], path)
+		if err != nil {
+			return nil, err
+		}
+
+		return n, nil
+	default:
+		return nil, notFound(path)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference
+// tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must be empty or start with a slash", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// index parses an array index token, which must not be greater than max.
+func index(token string, max int, path string) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("path %q contains an invalid array index", path)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("path %q contains an invalid array index", path)
+	}
+
+	if i > max {
+		return 0, notFound(path)
+	}
+
+	return i, nil
+}
+
+func notFound(path string) error {
+	return fmt.Errorf("path %q does not exist", path)
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	if dec.More() {
+		return nil, errors.New("body must only contain a single JSON value")
+	}
+
+	return value, nil
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		object := make(map[string]any, len(v))
+		for key, child := range v {
+			object[key] = deepCopy(child)
+		}
+		return object
+	case []any:
+		array := make([]any, len(v))
+		for i, child := range v {
+			array[i] = deepCopy(child)
+		}
+		return array
+	default:
+		return v
+	}
+}
+
+// equal compares two decoded JSON values as RFC 6902 "test" does, so numbers
+// are equal when they have the same value however they're written.
+func equal(a any, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		xf, errX := x.Float64()
+		yf, errY := y.Float64()
+		return errX == nil && errY == nil && xf == yf
+	default:
+		return a == b
+	}
+}
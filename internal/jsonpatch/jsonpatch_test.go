@@ -0,0 +1,193 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// assertJSON fails the test unless got and want encode the same JSON value.
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var compacted bytes.Buffer
+
+	if err := json.Compact(&compacted, []byte(want)); err != nil {
+		t.Fatalf("invalid expected JSON %q: %s", want, err)
+	}
+
+	// Objects are marshalled with sorted keys, so the expected documents are
+	// written that way too.
+	if string(got) != compacted.String() {
+		t.Errorf("got %s; want %s", got, compacted.String())
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replaces a member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"adds a member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"removes a null member", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"leaves the other members alone", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"replaces arrays whole", `{"a":["b"]}`, `{"a":["c","d"]}`, `{"a":["c","d"]}`},
+		{"replaces a non-object with an object", `{"a":"c"}`, `{"a":{"b":"c"}}`, `{"a":{"b":"c"}}`},
+		{"merges nested objects", `{"a":{"b":"c","d":"e"}}`, `{"a":{"b":null,"f":"g"}}`, `{"a":{"d":"e","f":"g"}}`},
+		{"drops nulls from added objects", `{}`, `{"a":{"b":null,"c":"d"}}`, `{"a":{"c":"d"}}`},
+		{"replaces the document with a non-object patch", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"replaces the document with null", `{"a":"b"}`, `null`, `null`},
+		{"keeps numbers as written", `{"a":1}`, `{"b":1.50}`, `{"a":1,"b":1.50}`},
+		{"merges into a non-object document", `["a"]`, `{"a":"b"}`, `{"a":"b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		patch       string
+		wantInvalid bool
+	}{
+		{"invalid document", `{"a":`, `{}`, true},
+		{"invalid patch", `{}`, `{"a":`, false},
+		{"several patch values", `{}`, `{} {}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if got := errors.Is(err, ErrInvalidDocument); got != tt.wantInvalid {
+				t.Errorf("errors.Is(err, ErrInvalidDocument) = %t; want %t", got, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		operations string
+		want       string
+	}{
+		{"adds a member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"adds over an existing member", `{"a":1}`, `[{"op":"add","path":"/a","value":2}]`, `{"a":2}`},
+		{"adds a nested member", `{"a":{}}`, `[{"op":"add","path":"/a/b","value":2}]`, `{"a":{"b":2}}`},
+		{"inserts into an array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"inserts at the end of an array by index", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`},
+		{"appends with the dash index", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"appends to an empty array with the dash index", `{"a":[]}`, `[{"op":"add","path":"/a/-","value":1}]`, `{"a":[1]}`},
+		{"replaces the root", `{"a":1}`, `[{"op":"add","path":"","value":[1]}]`, `[1]`},
+		{"unescapes a slash", `{}`, `[{"op":"add","path":"/a~1b","value":1}]`, `{"a/b":1}`},
+		{"unescapes a tilde", `{}`, `[{"op":"add","path":"/a~0b","value":1}]`, `{"a~b":1}`},
+		{"unescapes a tilde before a one", `{}`, `[{"op":"add","path":"/~01","value":1}]`, `{"~1":1}`},
+		{"adds an empty key", `{}`, `[{"op":"add","path":"/","value":1}]`, `{"":1}`},
+		{"removes a member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"removes an array element", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"replaces a member", `{"a":1}`, `[{"op":"replace","path":"/a","value":{"b":2}}]`, `{"a":{"b":2}}`},
+		{"replaces an array element", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":3}]`, `{"a":[3,2]}`},
+		{"moves a member", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"moves an array element", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`},
+		{"moves to the same path", `{"a":1}`, `[{"op":"move","from":"/a","path":"/a"}]`, `{"a":1}`},
+		{"moves to a sibling sharing a prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`},
+		{"copies a value", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{"copies deeply", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"tests a value", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`},
+		{"tests numbers by value", `{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`},
+		{"applies operations in order", `{}`, `[{"op":"add","path":"/a","value":[]},{"op":"add","path":"/a/-","value":1},{"op":"add","path":"/a/0","value":0}]`, `{"a":[0,1]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var operations []Operation
+
+			if err := json.Unmarshal([]byte(tt.operations), &operations); err != nil {
+				t.Fatalf("invalid operations: %s", err)
+			}
+
+			got, err := Apply([]byte(tt.doc), operations)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		doc        string
+		operations string
+		wantIndex  int
+	}{
+		{"unknown operation", `{}`, `[{"op":"merge","path":"/a"}]`, 0},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, 0},
+		{"path without a leading slash", `{}`, `[{"op":"add","path":"a","value":1}]`, 0},
+		{"missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, 0},
+		{"index past the end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, 0},
+		{"index with a leading zero", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/01","value":1}]`, 0},
+		{"negative index", `{"a":[1]}`, `[{"op":"remove","path":"/a/-1"}]`, 0},
+		{"dash index outside of add", `{"a":[1]}`, `[{"op":"replace","path":"/a/-","value":1}]`, 0},
+		{"replace of a missing member", `{}`, `[{"op":"replace","path":"/a","value":1}]`, 0},
+		{"remove of a missing member", `{}`, `[{"op":"remove","path":"/a"}]`, 0},
+		{"remove of the root", `{}`, `[{"op":"remove","path":""}]`, 0},
+		{"move into a child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, 0},
+		{"move from a missing path", `{}`, `[{"op":"move","from":"/a","path":"/b"}]`, 0},
+		{"failed test", `{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, 0},
+		{"failing second operation", `{}`, `[{"op":"add","path":"/a","value":1},{"op":"test","path":"/a","value":2}]`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var operations []Operation
+
+			if err := json.Unmarshal([]byte(tt.operations), &operations); err != nil {
+				t.Fatalf("invalid operations: %s", err)
+			}
+
+			got, err := Apply([]byte(tt.doc), operations)
+			if got != nil {
+				t.Errorf("got %s; want no document", got)
+			}
+
+			var operationError *OperationError
+
+			if !errors.As(err, &operationError) {
+				t.Fatalf("got error %v; want an *OperationError", err)
+			}
+
+			if operationError.Index != tt.wantIndex {
+				t.Errorf("got index %d; want %d", operationError.Index, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestApplyInvalidDocument(t *testing.T) {
+	_, err := Apply([]byte(`{"a":`), nil)
+	if !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("got error %v; want ErrInvalidDocument", err)
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Local stores files in a directory on the local disk, and serves them from
+// baseURL.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocal(dir, baseURL string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Put writes the file to a temporary file first and renames it into place, so
+// that readers never see a partially written file.
+func (store *Local) Put(key string, content io.Reader) error {
+	name, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, content)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func (store *Local) Open(key string) (io.ReadSeekCloser, time.Time, error) {
+	name, err := store.path(key)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil, time.Time{}, ErrNotFound
+		default:
+			return nil, time.Time{}, err
+		}
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, time.Time{}, err
+	}
+
+	if info.IsDir() {
+		file.Close()
+		return nil, time.Time{}, ErrNotFound
+	}
+
+	return file, info.ModTime(), nil
+}
+
+func (store *Local) Delete(key string) error {
+	name, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *Local) URL(key string) string {
+	return store.baseURL + "/" + key
+}
+
+// path maps a key to a file inside the storage directory, rejecting keys that
+// would escape it or name the directory itself.
+func (store *Local) path(key string) (string, error) {
+	if key == "" || key == "." || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(store.dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPath(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewLocal(dir, "http://localhost/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{"file", "poster.jpg", "poster.jpg"},
+		{"nested file", "posters/12/w185.jpg", filepath.Join("posters", "12", "w185.jpg")},
+		{"dotted name", "posters/..jpg", filepath.Join("posters", "..jpg")},
+		{"empty key", "", ""},
+		{"storage directory", ".", ""},
+		{"absolute key", "/etc/passwd", ""},
+		{"parent directory", "..", ""},
+		{"file in the parent directory", "../secret", ""},
+		{"traversal in the middle", "posters/../../secret", ""},
+		{"traversal resolving inside", "posters/../poster.jpg", ""},
+		{"current directory segment", "./poster.jpg", ""},
+		{"trailing slash", "posters/", ""},
+		{"double slash", "posters//poster.jpg", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.path(tt.key)
+
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("got %q, %v; want ErrInvalidKey", got, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLocalRoundTrip(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), "http://localhost/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := "posters/1/original.jpg"
+
+	if got, want := store.URL(key), "http://localhost/media/posters/1/original.jpg"; got != want {
+		t.Errorf("got URL %q; want %q", got, want)
+	}
+
+	err = store.Put(key, strings.NewReader("poster"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, _, err := store.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "poster" {
+		t.Errorf("got content %q; want %q", content, "poster")
+	}
+
+	if _, _, err := store.Open("posters/1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("opening a directory: got %v; want ErrNotFound", err)
+	}
+
+	err = store.Delete(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := store.Open(key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("opening a deleted file: got %v; want ErrNotFound", err)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Errorf("deleting a missing file: got %v; want nil", err)
+	}
+}
@@ -0,0 +1,23 @@
+// Package storage keeps uploaded files, such as movie posters, behind an
+// interface so that the backing store can be swapped out.
+package storage
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: file not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// Store saves files under slash-separated keys such as "posters/12/w185.jpg".
+// Saving a file under an existing key replaces it.
+type Store interface {
+	Put(key string, content io.Reader) error
+	Open(key string) (io.ReadSeekCloser, time.Time, error)
+	Delete(key string) error
+	URL(key string) string
+}
@@ -48,5 +48,5 @@ func Unique(values []string) bool {
 	for _, value := range values {
 		unique[value] = true
 	}
-	return len(values) == len(values)
+	return len(values) == len(unique)
 }
@@ -0,0 +1,9 @@
+-- One title index per supported text search language, matching the
+-- expressions built by MovieModel. The 'simple' index comes from 000003.
+CREATE INDEX IF NOT EXISTS movies_title_english_idx ON movies USING GIN (to_tsvector('english', title));
+
+CREATE INDEX IF NOT EXISTS movies_title_german_idx ON movies USING GIN (to_tsvector('german', title));
+
+CREATE INDEX IF NOT EXISTS movies_title_french_idx ON movies USING GIN (to_tsvector('french', title));
+
+CREATE INDEX IF NOT EXISTS movies_title_spanish_idx ON movies USING GIN (to_tsvector('spanish', title));
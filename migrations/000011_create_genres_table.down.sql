@@ -0,0 +1,15 @@
+DELETE FROM permissions WHERE code = 'genres:write';
+
+-- The up migration is one-way for movies.genres: spellings of the same genre
+-- were merged into a single slug, so the original strings can't be told apart
+-- anymore. The closest thing left is the display name of each genre, which is
+-- the first spelling seen when the catalog was backfilled.
+UPDATE movies
+SET genres = ARRAY(
+  SELECT COALESCE(genres.name, genre)
+  FROM unnest(movies.genres) WITH ORDINALITY AS slugs (genre, ord)
+  LEFT JOIN genres ON genres.slug = slugs.genre
+  ORDER BY slugs.ord
+);
+
+DROP TABLE IF EXISTS genres;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS genres (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  slug text UNIQUE NOT NULL,
+  name text NOT NULL,
+  version integer NOT NULL DEFAULT 1
+);
+
+-- Backfill the catalog from the free-form genres already stored on movies,
+-- keeping the first spelling seen for each slug as its display name. Slugs
+-- are built the same way as data.GenreSlug builds them.
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (slug) slug, trim(genre)
+FROM (
+  SELECT genre, trim(BOTH '-' FROM regexp_replace(lower(genre), '[^[:alnum:]]+', '-', 'g')) AS slug
+  FROM movies, unnest(movies.genres) AS genre
+) AS spellings
+WHERE slug <> ''
+ORDER BY slug, genre
+ON CONFLICT (slug) DO NOTHING;
+
+-- Store slugs on movies from now on, merging spellings of the same genre.
+UPDATE movies
+SET genres = ARRAY(
+  SELECT DISTINCT trim(BOTH '-' FROM regexp_replace(lower(genre), '[^[:alnum:]]+', '-', 'g'))
+  FROM unnest(movies.genres) AS genre
+);
+
+INSERT INTO permissions (code) VALUES ('genres:write');
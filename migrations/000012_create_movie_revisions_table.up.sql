@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS movie_revisions (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  version integer NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  user_id bigint REFERENCES users ON DELETE SET NULL,
+  snapshot jsonb NOT NULL,
+  changes jsonb NOT NULL,
+  PRIMARY KEY (movie_id, version)
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key text NOT NULL,
+  user_id bigint NOT NULL,
+  request_path text NOT NULL,
+  fingerprint bytea NOT NULL,
+  status integer,
+  headers jsonb,
+  body bytea,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  expires_at timestamp(0) with time zone NOT NULL
+);
+
+-- Keys are scoped to the user who sent them. Anonymous requests are stored with
+-- user_id 0 and have no user to scope them by, so their keys are scoped by the
+-- request fingerprint instead: replaying a response takes the same body.
+CREATE UNIQUE INDEX IF NOT EXISTS idempotency_keys_user_idx ON idempotency_keys (key, user_id, request_path) WHERE user_id <> 0;
+CREATE UNIQUE INDEX IF NOT EXISTS idempotency_keys_anonymous_idx ON idempotency_keys (key, request_path, fingerprint) WHERE user_id = 0;
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,4 @@
+ALTER TABLE movies DROP COLUMN IF EXISTS backdrop_thumbnails;
+ALTER TABLE movies DROP COLUMN IF EXISTS backdrop_url;
+ALTER TABLE movies DROP COLUMN IF EXISTS poster_thumbnails;
+ALTER TABLE movies DROP COLUMN IF EXISTS poster_url;
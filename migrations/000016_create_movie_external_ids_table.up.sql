@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS movie_external_ids (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  source text NOT NULL,
+  external_id text NOT NULL,
+  PRIMARY KEY (movie_id, source),
+  UNIQUE (source, external_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_title_year_idx ON movies (lower(title), year);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS lists (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  name text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  is_public bool NOT NULL DEFAULT false,
+  is_default bool NOT NULL DEFAULT false,
+  version integer NOT NULL DEFAULT 1,
+  UNIQUE (user_id, name)
+);
+
+-- Every user has at most one default list, their watchlist.
+CREATE UNIQUE INDEX IF NOT EXISTS lists_user_id_default_idx ON lists (user_id) WHERE is_default;
+
+-- Positions are kept gapless by the model rather than by a unique constraint,
+-- since shifting them would violate it halfway through an update.
+CREATE TABLE IF NOT EXISTS list_items (
+  list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  position integer NOT NULL,
+  added_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS list_items_list_id_position_idx ON list_items (list_id, position);
+CREATE INDEX IF NOT EXISTS list_items_movie_id_idx ON list_items (movie_id);
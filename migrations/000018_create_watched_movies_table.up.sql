@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS watched_movies (
+  id bigserial PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  watched_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS watched_movies_user_id_movie_id_idx ON watched_movies (user_id, movie_id);
+CREATE INDEX IF NOT EXISTS watched_movies_user_id_watched_at_idx ON watched_movies (user_id, watched_at);
@@ -0,0 +1,11 @@
+-- The movies most similar to each movie, precomputed by a background job since
+-- scoring every pair of movies is too slow to do per request.
+CREATE TABLE IF NOT EXISTS movie_similarity (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  similar_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  score real NOT NULL,
+  PRIMARY KEY (movie_id, similar_id)
+);
+
+CREATE INDEX IF NOT EXISTS movie_similarity_movie_id_score_idx ON movie_similarity (movie_id, score DESC);
+CREATE INDEX IF NOT EXISTS movie_similarity_similar_id_idx ON movie_similarity (similar_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_neighbors;
+DROP VIEW IF EXISTS movie_interactions;
@@ -0,0 +1,19 @@
+-- The movies each user has shown an interest in: the ones they watched or rated
+-- 6 or more, but not the ones they rated below that.
+CREATE OR REPLACE VIEW movie_interactions AS
+  SELECT user_id, movie_id FROM watched_movies
+  UNION
+  SELECT user_id, movie_id FROM reviews WHERE rating >= 6
+  EXCEPT
+  SELECT user_id, movie_id FROM reviews WHERE rating < 6;
+
+-- The movies most often liked by the same users as each movie, precomputed by
+-- a background job for item-based recommendations.
+CREATE TABLE IF NOT EXISTS movie_neighbors (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  neighbor_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  score real NOT NULL,
+  PRIMARY KEY (movie_id, neighbor_id)
+);
+
+CREATE INDEX IF NOT EXISTS movie_neighbors_neighbor_id_idx ON movie_neighbors (neighbor_id);